@@ -1,3 +1,5 @@
+curl -X POST http://127.0.0.1:8081/admin/init
+
 curl -X POST http://127.0.0.1:8081/api/create \
      -H "Content-Type: application/json" \
      -d '{"key": "exampleKey", "value": "exampleValue"}' -vvvv
@@ -17,3 +19,11 @@ curl -X POST http://127.0.0.1:8081/api/delete \
 curl -X POST http://127.0.0.1:8081/api/cas \
      -H "Content-Type: application/json" \
      -d '{"key": "exampleKey", "value": "newValue", "compare_value": "oldValue"}'
+
+curl -X POST http://127.0.0.1:8081/api/register_client
+
+curl -X POST http://127.0.0.1:8081/api/create \
+     -H "Content-Type: application/json" \
+     -d '{"key": "sessionKey", "value": "value", "client_id": 1, "sequence": 1}'
+
+curl -X GET http://127.0.0.1:8081/api/status
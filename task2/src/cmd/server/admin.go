@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"raft/pkg/config"
+	"raft/pkg/raft"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) InitRequestHandler(c echo.Context) error {
+	for _, g := range s.groups {
+		if g.node.ClusterID() != "" {
+			return c.JSON(http.StatusConflict, raft.ErrAlreadyBootstrapped.Error())
+		}
+	}
+
+	clusterID := raft.NewClusterID()
+	for _, g := range s.groups {
+		if err := g.node.Bootstrap(clusterID); err != nil {
+			return c.JSON(http.StatusConflict, fmt.Sprintf("group %d: %s", g.ID, err))
+		}
+	}
+	return c.JSON(http.StatusOK, struct {
+		ClusterID string `json:"cluster_id"`
+	}{
+		ClusterID: clusterID,
+	})
+}
+
+// initCluster asks the locally running node to bootstrap a new cluster.
+func initCluster(config *config.Config) error {
+	resp, err := http.Post("http://"+config.Addresses[config.ID]+"/admin/init", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(string(body))
+	}
+	fmt.Println(string(body))
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+type batchRequest struct {
+	Session
+	Ops []txnOp `json:"ops"`
+}
+
+type batchResponse struct {
+	Results []kv.BatchResult `json:"results"`
+}
+
+func batchKeys(body []byte) ([]string, error) {
+	var req batchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(req.Ops))
+	for _, op := range req.Ops {
+		keys = append(keys, op.Key)
+	}
+	return keys, nil
+}
+
+// BatchRequestHandler runs many independent ops, proposed as one log entry
+// per group owning some of their keys. Ops are not atomic: each one reports
+// its own result or error, in request order, and a group that cannot take
+// its ops fails only those. A batch with a session, a namespace or a
+// group_id belongs to that one group, so its keys must too.
+func (s *Server) BatchRequestHandler(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return readError(c, err)
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	inGroup := s.routeBy(true, batchKeys)(s.proposeBatch)
+
+	var req struct {
+		batchRequest
+		GroupID *int `json:"group_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	ns, err := requestNamespace(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.ClientID != 0 || req.GroupID != nil || ns != "" {
+		return inGroup(c)
+	}
+
+	owned := make(map[*Group][]int)
+	for i, op := range req.Ops {
+		if storage.IsReserved(op.Key) {
+			return c.JSON(http.StatusBadRequest, storage.ErrKeyReserved.Error())
+		}
+		g, err := s.groupForKey(op.Key)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		owned[g] = append(owned[g], i)
+	}
+	if len(owned) <= 1 {
+		return inGroup(c)
+	}
+	ops, err := convertOps(req.Ops)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := kv.ValidateBatch(ops); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	resp := batchResponse{Results: make([]kv.BatchResult, len(ops))}
+	for _, g := range s.groups {
+		indices := owned[g]
+		if len(indices) == 0 {
+			continue
+		}
+		var results []kv.BatchResult
+		if g.node.IsLeader() {
+			groupOps := make([]raft.TxnOp, len(indices))
+			for j, i := range indices {
+				groupOps[j] = ops[i]
+			}
+			results, err = g.batch(c, groupOps)
+		} else {
+			groupReq := batchRequest{Ops: make([]txnOp, len(indices))}
+			for j, i := range indices {
+				groupReq.Ops[j] = req.Ops[i]
+			}
+			results, err = s.forwardBatch(c, g, groupReq)
+		}
+		if err == nil && len(results) != len(indices) {
+			err = fmt.Errorf("group %d answered %d of %d ops", g.ID, len(results), len(indices))
+		}
+		for j, i := range indices {
+			if err != nil {
+				resp.Results[i] = kv.BatchResult{OpResult: kv.OpResult{Key: req.Ops[i].Key}, Error: errorMessage(err)}
+			} else {
+				resp.Results[i] = results[j]
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// proposeBatch runs a batch whose keys all belong to the group it was
+// routed to.
+func (s *Server) proposeBatch(c echo.Context) error {
+	var req batchRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	ops, err := convertOps(req.Ops)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := kv.ValidateBatch(ops); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+	result, err := g.propose(c, raft.LogEntry{
+		Command:  raft.OpBatch,
+		ClientID: req.ClientID,
+		Sequence: req.Sequence,
+		Ops:      ops,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Results any `json:"results"`
+	}{
+		Results: result,
+	})
+}
+
+// batch proposes the ops of a split batch that this node's group leads.
+func (g *Group) batch(c echo.Context, ops []raft.TxnOp) ([]kv.BatchResult, error) {
+	if err := g.statusCheck(c); err != nil {
+		return nil, raft.ErrNotLeader
+	}
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpBatch,
+		Ops:     ops,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]kv.BatchResult), nil
+}
+
+// forwardBatch hands the ops of a split batch to the leader of their group.
+func (s *Server) forwardBatch(c echo.Context, g *Group, req batchRequest) ([]kv.BatchResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp batchResponse
+	if err := s.postToLeader(c, g, "/api/batch", echo.MIMEApplicationJSON, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// errorMessage is the text of err as a client sees it, for a forwarded
+// request the message the leader responded with.
+func errorMessage(err error) string {
+	var forwarded *echo.HTTPError
+	if errors.As(err, &forwarded) {
+		return fmt.Sprint(forwarded.Message)
+	}
+	return err.Error()
+}
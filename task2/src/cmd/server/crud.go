@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"raft/pkg/jsonvalue"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrKeyNotFound),
+		errors.Is(err, storage.ErrKeyExists),
+		errors.Is(err, storage.ErrKeyChanged),
+		errors.Is(err, storage.ErrKeyReserved),
+		errors.Is(err, storage.ErrFutureRevision),
+		errors.Is(err, storage.ErrNotLockOwner),
+		errors.Is(err, storage.ErrNotNumber),
+		errors.Is(err, storage.ErrOutOfBounds),
+		errors.Is(err, kv.ErrStaleSequence),
+		errors.Is(err, kv.ErrBadSequence),
+		errors.Is(err, storage.ErrBadNamespace),
+		errors.Is(err, kv.ErrBadTxn):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNamespaceExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrKeyTooLarge),
+		errors.Is(err, ErrValueTooLarge),
+		errors.Is(err, ErrRequestTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrQuotaExceeded),
+		errors.Is(err, ErrNamespaceQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, storage.ErrCompacted):
+		return http.StatusGone
+	case errors.Is(err, storage.ErrLeaseNotFound),
+		errors.Is(err, storage.ErrNamespaceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, kv.ErrSessionExpired):
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) CreateRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Session
+		Payload
+		Key   string `json:"key" query:"key"`
+		TTL   int64  `json:"ttl_ms" query:"ttl_ms"`
+		Lease int    `json:"lease" query:"lease"`
+	}
+	if err := bindPayload(c, &req, &req.Payload); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.TTL < 0 {
+		return c.JSON(http.StatusBadRequest, "ttl_ms must not be negative")
+	}
+	value := req.value()
+	entry := raft.LogEntry{
+		Command:      raft.OpCreate,
+		ClientID:     req.ClientID,
+		Sequence:     req.Sequence,
+		Key:          req.Key,
+		Value:        &value,
+		CompareValue: nil,
+		TTL:          req.TTL,
+		Lease:        req.Lease,
+		ContentType:  req.ContentType,
+	}
+	return g.write(c, entry)
+}
+
+func (s *Server) ReadRequestHandler(c echo.Context) error {
+	g := group(c)
+	if g.node.IsLeader() {
+		if err := g.statusCheck(c); err != nil {
+			return c.JSON(http.StatusServiceUnavailable, err.Error())
+		}
+	}
+
+	var req struct {
+		Key      string `json:"key" query:"key"`
+		Revision int    `json:"revision" query:"revision"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	var version storage.Version
+	var err error
+	if req.Revision > 0 {
+		version, err = g.storage.GetAt(nsKey(c, req.Key), req.Revision)
+	} else {
+		version, err = g.storage.GetVersion(nsKey(c, req.Key))
+	}
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	setETag(c, version.ETag())
+	if etags := parseETags(c.Request().Header.Get("If-None-Match")); storage.Matches(etags, version, true) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	if acceptsRaw(c) {
+		return rawValue(c, version)
+	}
+
+	var ttl int64
+	if version.ExpiresAt > 0 && req.Revision == 0 {
+		ttl = max(version.ExpiresAt-time.Now().UnixMilli(), 1)
+	}
+	value, binary := jsonvalue.Encode(version.Value)
+	return c.JSON(http.StatusOK, struct {
+		Value       string `json:"value,omitempty"`
+		ValueBase64 []byte `json:"value_base64,omitempty"`
+		ContentType string `json:"content_type,omitempty"`
+		Revision    int    `json:"revision"`
+		Version     int    `json:"version"`
+		ETag        string `json:"etag"`
+		TTL         int64  `json:"ttl_ms,omitempty"`
+		Lease       int    `json:"lease,omitempty"`
+	}{
+		Value:       value,
+		ValueBase64: binary,
+		ContentType: version.ContentType,
+		Revision:    version.Revision,
+		Version:     version.Version,
+		ETag:        version.ETag(),
+		TTL:         ttl,
+		Lease:       version.Lease,
+	})
+}
+
+func (s *Server) UpdateRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Session
+		Payload
+		Key   string `json:"key" query:"key"`
+		TTL   int64  `json:"ttl_ms" query:"ttl_ms"`
+		Lease int    `json:"lease" query:"lease"`
+	}
+	if err := bindPayload(c, &req, &req.Payload); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.TTL < 0 {
+		return c.JSON(http.StatusBadRequest, "ttl_ms must not be negative")
+	}
+	value := req.value()
+	entry := raft.LogEntry{
+		Command:     raft.OpSet,
+		ClientID:    req.ClientID,
+		Sequence:    req.Sequence,
+		Key:         req.Key,
+		Value:       &value,
+		TTL:         req.TTL,
+		Lease:       req.Lease,
+		ContentType: req.ContentType,
+		IfMatch:     parseETags(c.Request().Header.Get("If-Match")),
+		IfNoneMatch: parseETags(c.Request().Header.Get("If-None-Match")),
+	}
+	return g.write(c, entry)
+}
+
+func (s *Server) DeleteRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+	var req struct {
+		Session
+		Key string `json:"key"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entry := raft.LogEntry{
+		Command:     raft.OpDelete,
+		ClientID:    req.ClientID,
+		Sequence:    req.Sequence,
+		Key:         req.Key,
+		IfMatch:     parseETags(c.Request().Header.Get("If-Match")),
+		IfNoneMatch: parseETags(c.Request().Header.Get("If-None-Match")),
+	}
+	return g.replicate(c, entry)
+}
+
+func (s *Server) CASRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Session
+		Key                string  `json:"key"`
+		Value              string  `json:"value"`
+		ValueBase64        []byte  `json:"value_base64"`
+		CompareValue       *string `json:"compare_value"`
+		CompareValueBase64 []byte  `json:"compare_value_base64"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	compareValue := jsonValue(req.CompareValue, req.CompareValueBase64)
+	if compareValue == nil {
+		compareValue = new(string)
+	}
+	entry := raft.LogEntry{
+		Command:      raft.OpCAS,
+		ClientID:     req.ClientID,
+		Sequence:     req.Sequence,
+		Key:          req.Key,
+		Value:        jsonValue(&req.Value, req.ValueBase64),
+		CompareValue: compareValue,
+	}
+	return g.write(c, entry)
+}
+
+func (s *Server) IncrementRequestHandler(c echo.Context) error {
+	return s.counter(c, raft.OpIncrement)
+}
+
+func (s *Server) DecrementRequestHandler(c echo.Context) error {
+	return s.counter(c, raft.OpDecrement)
+}
+
+// counter moves an integer value by delta (1 by default) within the
+// optional min/max bounds, creating it from 0 when create is set.
+func (s *Server) counter(c echo.Context, command raft.OpCode) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Session
+		Key    string `json:"key"`
+		Delta  *int64 `json:"delta"`
+		Min    *int64 `json:"min"`
+		Max    *int64 `json:"max"`
+		Create bool   `json:"create"`
+		TTL    int64  `json:"ttl_ms"`
+		Lease  int    `json:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+	if delta < 0 {
+		return c.JSON(http.StatusBadRequest, "delta must not be negative")
+	}
+	if req.TTL < 0 {
+		return c.JSON(http.StatusBadRequest, "ttl_ms must not be negative")
+	}
+	result, err := g.propose(c, raft.LogEntry{
+		Command:  command,
+		ClientID: req.ClientID,
+		Sequence: req.Sequence,
+		Key:      req.Key,
+		Delta:    delta,
+		Min:      req.Min,
+		Max:      req.Max,
+		Create:   req.Create,
+		TTL:      req.TTL,
+		Lease:    req.Lease,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) CompactRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Revision int `json:"revision"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.Revision <= 0 {
+		return c.JSON(http.StatusBadRequest, "revision must be positive")
+	}
+	entry := raft.LogEntry{
+		Command:  raft.OpCompact,
+		Revision: req.Revision,
+	}
+	return g.replicate(c, entry)
+}
+
+func (s *Server) GetReplicasRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+	return c.JSON(http.StatusOK, struct {
+		Replicas []string `json:"replicas"`
+	}{
+		Replicas: g.node.Peers(),
+	})
+}
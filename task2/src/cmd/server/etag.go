@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseETags reads an If-Match or If-None-Match header. Weak tags compare
+// like strong ones: every ETag here names one exact version.
+func parseETags(header string) []string {
+	if header == "" {
+		return nil
+	}
+	etags := make([]string, 0)
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		etags = append(etags, strings.Trim(etag, `"`))
+	}
+	return etags
+}
+
+func setETag(c echo.Context, etag string) {
+	c.Response().Header().Set("ETag", `"`+etag+`"`)
+}
+
+// write proposes a create, update or cas and answers with the version it
+// left. Results replayed from a session come back as raw JSON.
+func (g *Group) write(c echo.Context, entry raft.LogEntry) error {
+	result, err := g.propose(c, entry)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var written kv.WriteResult
+	switch r := result.(type) {
+	case kv.WriteResult:
+		written = r
+	case json.RawMessage:
+		if err := json.Unmarshal(r, &written); err != nil {
+			return c.JSON(http.StatusInternalServerError, err.Error())
+		}
+	}
+	if written.ETag != "" {
+		setETag(c, written.ETag)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Success bool `json:"success"`
+		kv.WriteResult
+	}{
+		Success:     true,
+		WriteResult: written,
+	})
+}
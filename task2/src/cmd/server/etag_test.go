@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"raft/pkg/config"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseETags(t *testing.T) {
+	for header, want := range map[string][]string{
+		``:                nil,
+		`*`:               {"*"},
+		`"3.1"`:           {"3.1"},
+		`W/"3.1", "4.2" `: {"3.1", "4.2"},
+		`"3.1",W/"4.2",*`: {"3.1", "4.2", "*"},
+	} {
+		if got := parseETags(header); !slices.Equal(got, want) {
+			t.Errorf("parseETags(%q): got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestReadAnswersNotModified(t *testing.T) {
+	g := newTestGroup(t, config.GroupConfig{})
+	putKeys(t, g, "a")
+	read := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/read?key=a", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("group", g)
+		c.Set("namespace", "")
+		if err := (&Server{}).ReadRequestHandler(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	etag := read("").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("read has no ETag")
+	}
+	for header, want := range map[string]int{
+		etag:             http.StatusNotModified,
+		"W/" + etag:      http.StatusNotModified,
+		"*":              http.StatusNotModified,
+		`"0.0"`:          http.StatusOK,
+		`"0.0", ` + etag: http.StatusNotModified,
+	} {
+		if rec := read(header); rec.Code != want {
+			t.Errorf("If-None-Match %s: got %d, want %d", header, rec.Code, want)
+		}
+	}
+}
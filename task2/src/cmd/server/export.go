@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"raft/pkg/config"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const mimeJSONLines = "application/x-ndjson"
+
+// ExportRequestHandler streams the keys of every group on this node, or of
+// the group given by group_id or holding the namespace, as JSONL records.
+// Each group is dumped as of one revision, its latest unless revision is
+// given, which the X-Revision header reports for single-group exports.
+func (s *Server) ExportRequestHandler(c echo.Context) error {
+	var req struct {
+		GroupID  *int `query:"group_id"`
+		Revision int  `query:"revision"`
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	ns, err := requestNamespace(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	groups := s.groups
+	switch {
+	case ns != "":
+		g, err := s.groupForKey(ns)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		if _, _, err := g.storage.Namespace(ns); err != nil {
+			return errorResponse(c, err)
+		}
+		groups = []*Group{g}
+	case req.GroupID != nil:
+		g, err := s.groupByID(*req.GroupID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		groups = []*Group{g}
+	}
+	if req.Revision < 0 {
+		return c.JSON(http.StatusBadRequest, "revision must not be negative")
+	}
+	if req.Revision > 0 && len(groups) > 1 {
+		return c.JSON(http.StatusBadRequest, "revision needs group_id or namespace")
+	}
+
+	revisions := make([]int, len(groups))
+	for i, g := range groups {
+		if g.node.IsLeader() {
+			if err := g.statusCheck(c); err != nil {
+				return c.JSON(http.StatusServiceUnavailable, err.Error())
+			}
+		}
+		revisions[i] = req.Revision
+		if revisions[i] == 0 {
+			revisions[i] = g.storage.Revision()
+		}
+	}
+
+	res := c.Response()
+	// Large dumps outlive the server write timeout.
+	if err := http.NewResponseController(res.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	res.Header().Set(echo.HeaderContentType, mimeJSONLines)
+	if len(groups) == 1 {
+		res.Header().Set("X-Revision", strconv.Itoa(revisions[0]))
+	}
+
+	// The status goes out with the first record, so an export failing
+	// before it can still answer with an error.
+	enc := json.NewEncoder(res)
+	started := false
+	for i, g := range groups {
+		err := g.storage.Export(revisions[i], func(record storage.Record) error {
+			if ns != "" && record.Namespace != ns {
+				return nil
+			}
+			if !started {
+				res.WriteHeader(http.StatusOK)
+				started = true
+			}
+			return enc.Encode(record)
+		})
+		if err != nil && !started {
+			return errorResponse(c, err)
+		}
+		if err != nil {
+			log.Printf("Failed to export group %d: %v", g.ID, err)
+			return nil
+		}
+	}
+	if !started {
+		res.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+type groupImport struct {
+	GroupID int `json:"group_id"`
+	kv.ImportResult
+}
+
+type importResponse struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Groups   []groupImport `json:"groups"`
+}
+
+// ImportRequestHandler loads JSONL records as written by export. The keys
+// of each group go to its leader as one bulk entry, so a group imports all
+// of its keys or none; groups import independently. Keys that expired
+// since the export are skipped, and namespaces must exist already. Bodies
+// are capped at max_request_bytes, so the import CLI sends them in batches
+// that each commit on their own.
+func (s *Server) ImportRequestHandler(c echo.Context) error {
+	var only *Group
+	if id := c.QueryParam("group_id"); id != "" {
+		groupID, err := strconv.Atoi(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		if only, err = s.groupByID(groupID); err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	records := make(map[*Group][]storage.Record)
+	var resp importResponse
+	now := time.Now().UnixMilli()
+	dec := json.NewDecoder(c.Request().Body)
+	for {
+		var record storage.Record
+		if err := dec.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return readError(c, err)
+		}
+		if record.Key == "" || storage.IsReserved(record.Key) {
+			return c.JSON(http.StatusBadRequest, fmt.Sprintf("bad key %q", record.Key))
+		}
+		owner := record.Key
+		if record.Namespace != "" {
+			if err := storage.ValidateNamespace(record.Namespace); err != nil {
+				return c.JSON(http.StatusBadRequest, err.Error())
+			}
+			owner = record.Namespace
+		}
+		if record.ExpiresAt > 0 && record.ExpiresAt <= now {
+			resp.Skipped++
+			continue
+		}
+		g, err := s.groupForKey(owner)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		if only != nil && g != only {
+			return c.JSON(http.StatusBadRequest, ErrCrossGroup.Error())
+		}
+		records[g] = append(records[g], record)
+	}
+
+	resp.Groups = make([]groupImport, 0)
+	for _, g := range s.groups {
+		if len(records[g]) == 0 {
+			continue
+		}
+		var result importResponse
+		var err error
+		if g.node.IsLeader() {
+			result, err = g.importRecords(c, records[g], now)
+		} else {
+			result, err = s.forwardImport(c, g, records[g])
+		}
+		var forwarded *echo.HTTPError
+		if errors.As(err, &forwarded) {
+			return c.JSON(forwarded.Code, forwarded.Message)
+		}
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		resp.Imported += result.Imported
+		resp.Groups = append(resp.Groups, result.Groups...)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (g *Group) importRecords(c echo.Context, records []storage.Record, now int64) (importResponse, error) {
+	if err := g.statusCheck(c); err != nil {
+		return importResponse{}, raft.ErrNotLeader
+	}
+	ops := make([]raft.TxnOp, len(records))
+	byNamespace := make(map[string][]raft.TxnOp)
+	for i, record := range records {
+		ops[i] = raft.TxnOp{
+			Command:     raft.OpSet,
+			Key:         storage.NamespaceKey(record.Namespace, record.Key),
+			Value:       &record.Value,
+			ContentType: record.ContentType,
+		}
+		if record.ExpiresAt > 0 {
+			ops[i].TTL = max(record.ExpiresAt-now, 1)
+		}
+		byNamespace[record.Namespace] = append(byNamespace[record.Namespace], ops[i])
+	}
+	for ns, ops := range byNamespace {
+		if err := g.checkNamespaceQuota(ns, ops); err != nil {
+			return importResponse{}, err
+		}
+	}
+
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpImport,
+		Ops:     ops,
+	})
+	if err != nil {
+		return importResponse{}, err
+	}
+	imported := result.(kv.ImportResult)
+	return importResponse{
+		Imported: imported.Keys,
+		Groups:   []groupImport{{GroupID: g.ID, ImportResult: imported}},
+	}, nil
+}
+
+// forwardImport hands the records of a group to its leader.
+func (s *Server) forwardImport(c echo.Context, g *Group, records []storage.Record) (importResponse, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return importResponse{}, err
+		}
+	}
+	var result importResponse
+	path := "/admin/import?group_id=" + strconv.Itoa(g.ID)
+	err := s.postToLeader(c, g, path, mimeJSONLines, body.Bytes(), &result)
+	return result, err
+}
+
+// exportKeys writes a dump from the locally running node to stdout.
+func exportKeys(config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	group := flags.Int("group", -1, "group to export; every group when negative")
+	revision := flags.Int("revision", 0, "revision to export at; the latest when 0")
+	namespace := flags.String("namespace", "", "namespace to export; every one when empty")
+	flags.Parse(args)
+
+	query := url.Values{}
+	if *group >= 0 {
+		query.Set("group_id", strconv.Itoa(*group))
+	}
+	if *revision > 0 {
+		query.Set("revision", strconv.Itoa(*revision))
+	}
+	if *namespace != "" {
+		query.Set("namespace", *namespace)
+	}
+	resp, err := http.Get("http://" + config.Addresses[config.ID] + "/admin/export?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.New(string(body))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// importKeys loads a dump, from the file given or stdin, through the
+// locally running node, batch records per request. The import is chunked:
+// every request commits on its own, so a failed one leaves those before it
+// in place. Records overwrite their keys, so sending some again is harmless
+// and a failed import resumes with -skip at the records it reports done.
+func importKeys(config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	batch := flags.Int("batch", 1000, "records per request")
+	skip := flags.Int("skip", 0, "records to skip, to resume a failed import")
+	flags.Parse(args)
+	if *batch <= 0 {
+		return errors.New("batch must be positive")
+	}
+	if *skip < 0 {
+		return errors.New("skip must not be negative")
+	}
+
+	in := os.Stdin
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	send := func(body []byte) error {
+		resp, err := http.Post("http://"+config.Addresses[config.ID]+"/admin/import", mimeJSONLines, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		result, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return errors.New(string(result))
+		}
+		fmt.Print(string(result))
+		return nil
+	}
+
+	reader := bufio.NewReader(in)
+	var body bytes.Buffer
+	lines := 0
+	done := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if done < *skip {
+				done++
+			} else {
+				body.Write(line)
+				lines++
+			}
+		}
+		if lines == *batch || err == io.EOF && lines > 0 {
+			if err := send(body.Bytes()); err != nil {
+				return fmt.Errorf("%d records done, resume with -skip %d: %w", done, done, err)
+			}
+			done += lines
+			body.Reset()
+			lines = 0
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"path/filepath"
+	"raft/pkg/config"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrNoGroup        = errors.New("no group owns this key")
+	ErrUnknownGroup   = errors.New("unknown group")
+	ErrCrossGroup     = errors.New("keys belong to different groups")
+	ErrPrefixSpans    = errors.New("prefix spans several groups; watch each with group_id")
+	ErrForeignSession = errors.New("client_id was registered with another group")
+	ErrForeignLease   = errors.New("lease was granted by another group")
+)
+
+type Group struct {
+	config.GroupConfig
+
+	config  *config.Config
+	node    *raft.Raft
+	store   *raft.FileStore
+	storage *storage.Storage
+}
+
+func NewGroup(config *config.Config, gc config.GroupConfig, transport *raft.HTTPTransport) (*Group, error) {
+	dir := filepath.Join(config.DataDir, fmt.Sprintf("group-%d", gc.ID))
+	store, err := raft.NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := newEngine(config, dir)
+	if err != nil {
+		return nil, fmt.Errorf("group %d: %w", gc.ID, err)
+	}
+	storage, err := storage.NewStorage(engine)
+	if err != nil {
+		engine.Close()
+		return nil, fmt.Errorf("group %d: %w", gc.ID, err)
+	}
+	fsm, err := kv.NewStateMachine(storage, gc.ID, config.SessionTimeout)
+	if err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("group %d: %w", gc.ID, err)
+	}
+	node, err := raft.NewRaft(config, transport.Group(gc.ID), fsm, store)
+	if err != nil {
+		store.Close()
+		storage.Close()
+		return nil, fmt.Errorf("group %d: %w", gc.ID, err)
+	}
+	return &Group{
+		GroupConfig: gc,
+		config:      config,
+		node:        node,
+		store:       store,
+		storage:     storage,
+	}, nil
+}
+
+func newEngine(config *config.Config, dir string) (storage.Engine, error) {
+	if config.Engine == "memory" {
+		return storage.NewMemoryEngine(), nil
+	}
+	return storage.NewDiskEngine(dir)
+}
+
+func (g *Group) Close() {
+	g.node.Stop()
+	if err := g.store.Close(); err != nil {
+		log.Printf("Failed to close raft log of group %d: %v", g.ID, err)
+	}
+	if err := g.storage.Close(); err != nil {
+		log.Printf("Failed to close storage of group %d: %v", g.ID, err)
+	}
+}
+
+func (g *Group) Owns(key string) bool {
+	return key >= g.Start && (g.End == "" || key < g.End)
+}
+
+func (g *Group) statusCheck(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), g.config.ResponseTimeout)
+	defer cancel()
+
+	return g.node.WaitReady(ctx)
+}
+
+func (g *Group) propose(c echo.Context, entry raft.LogEntry) (any, error) {
+	ns := namespace(c)
+	entry = scope(ns, entry)
+	if err := g.checkLimits(ns, entry); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), g.config.ResponseTimeout)
+	defer cancel()
+
+	return g.node.Replicate(ctx, entry)
+}
+
+func (g *Group) replicate(c echo.Context, entry raft.LogEntry) error {
+	_, err := g.propose(c, entry)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Success bool `json:"success"`
+	}{
+		Success: true,
+	})
+}
+
+func (s *Server) groupByID(id int) (*Group, error) {
+	for _, g := range s.groups {
+		if g.ID == id {
+			return g, nil
+		}
+	}
+	return nil, ErrUnknownGroup
+}
+
+func (s *Server) groupForKey(key string) (*Group, error) {
+	if s.config.Sharding == "hash" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return s.groups[int(h.Sum32()%uint32(len(s.groups)))], nil
+	}
+	for _, g := range s.groups {
+		if g.Owns(key) {
+			return g, nil
+		}
+	}
+	return nil, ErrNoGroup
+}
+
+// holdsPrefix reports whether g owns every key with prefix.
+func (s *Server) holdsPrefix(g *Group, prefix string) bool {
+	if s.config.Sharding == "hash" {
+		return len(s.groups) == 1
+	}
+	end := storage.PrefixEnd(prefix)
+	return g.Owns(prefix) && (g.End == "" || end != "" && end <= g.End)
+}
+
+func (s *Server) groupForKeys(keys []string) (*Group, error) {
+	var owner *Group
+	for _, key := range keys {
+		g, err := s.groupForKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil && owner != g {
+			return nil, ErrCrossGroup
+		}
+		owner = g
+	}
+	if owner == nil {
+		return s.groupForKey("")
+	}
+	return owner, nil
+}
+
+func group(c echo.Context) *Group {
+	return c.Get("group").(*Group)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type leaseResponse struct {
+	Lease   int   `json:"lease"`
+	TTL     int64 `json:"ttl_ms"`
+	GroupID int   `json:"group_id"`
+}
+
+// GrantLeaseRequestHandler grants a lease in the group owning key or
+// group_id. Only keys of that group can be attached to it.
+func (s *Server) GrantLeaseRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		TTL int64 `json:"ttl_ms"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.TTL <= 0 {
+		return c.JSON(http.StatusBadRequest, "ttl_ms must be positive")
+	}
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpGrantLease,
+		TTL:     req.TTL,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	lease := result.(storage.Lease)
+	return c.JSON(http.StatusOK, leaseResponse{
+		Lease:   lease.ID,
+		TTL:     lease.TTL,
+		GroupID: g.ID,
+	})
+}
+
+func (s *Server) KeepAliveRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Lease int `json:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpKeepAlive,
+		Lease:   req.Lease,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	lease := result.(storage.Lease)
+	return c.JSON(http.StatusOK, leaseResponse{
+		Lease:   lease.ID,
+		TTL:     lease.TTL,
+		GroupID: g.ID,
+	})
+}
+
+func (s *Server) RevokeLeaseRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Lease int `json:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entry := raft.LogEntry{
+		Command: raft.OpRevokeLease,
+		Lease:   req.Lease,
+	}
+	return g.replicate(c, entry)
+}
+
+func (s *Server) LeaseInfoRequestHandler(c echo.Context) error {
+	g := group(c)
+	if g.node.IsLeader() {
+		if err := g.statusCheck(c); err != nil {
+			return c.JSON(http.StatusServiceUnavailable, err.Error())
+		}
+	}
+
+	var req struct {
+		Lease int `json:"lease" query:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	lease, attached, err := g.storage.Lease(req.Lease)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	// Leases belong to the group, but only keys of the namespace are shown.
+	keys := make([]string, 0, len(attached))
+	for _, key := range attached {
+		if ns, key := storage.SplitKey(key); ns == namespace(c) {
+			keys = append(keys, key)
+		}
+	}
+	return c.JSON(http.StatusOK, struct {
+		Lease     int      `json:"lease"`
+		TTL       int64    `json:"ttl_ms"`
+		Remaining int64    `json:"remaining_ms"`
+		Keys      []string `json:"keys"`
+	}{
+		Lease:     lease.ID,
+		TTL:       lease.TTL,
+		Remaining: max(lease.ExpiresAt-time.Now().UnixMilli(), 0),
+		Keys:      keys,
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"raft/pkg/raft"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrKeyTooLarge     = errors.New("key exceeds max_key_bytes")
+	ErrValueTooLarge   = errors.New("value exceeds max_value_bytes")
+	ErrRequestTooLarge = errors.New("request body exceeds max_request_bytes")
+	ErrQuotaExceeded   = errors.New("group storage quota max_total_bytes exceeded")
+)
+
+// limitCodes tell clients which limit an error response is about.
+var limitCodes = map[error]string{
+	ErrKeyTooLarge:            "key_too_large",
+	ErrValueTooLarge:          "value_too_large",
+	ErrRequestTooLarge:        "request_too_large",
+	ErrQuotaExceeded:          "quota_exceeded",
+	ErrNamespaceQuotaExceeded: "namespace_quota_exceeded",
+}
+
+// limitError is the body of a response refused by a limit.
+type limitError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// errorResponse answers with the status of err and its message, along with
+// a code if a limit was hit.
+func errorResponse(c echo.Context, err error) error {
+	for limit, code := range limitCodes {
+		if errors.Is(err, limit) {
+			return c.JSON(errorStatus(err), limitError{Error: err.Error(), Code: code})
+		}
+	}
+	return errorResponse(c, err)
+}
+
+// readError answers a failed read of the request body.
+func readError(c echo.Context, err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errorResponse(c, ErrRequestTooLarge)
+	}
+	return c.JSON(http.StatusBadRequest, err.Error())
+}
+
+// entryOps lists every key an entry touches with the values it carries.
+func entryOps(entry raft.LogEntry) []raft.TxnOp {
+	ops := []raft.TxnOp{{
+		Key:          entry.Key,
+		Value:        entry.Value,
+		CompareValue: entry.CompareValue,
+	}}
+	if entry.Txn != nil {
+		for _, c := range entry.Txn.Compare {
+			ops = append(ops, raft.TxnOp{Key: c.Key})
+		}
+		ops = append(ops, entry.Txn.Success...)
+		ops = append(ops, entry.Txn.Failure...)
+	}
+	return append(ops, entry.Ops...)
+}
+
+// checkLimits refuses an entry before it reaches the log if a key or value
+// is too large, or if its writes would grow the group or the namespace past
+// its quota. Quotas are judged against applied data, so entries in flight
+// may overshoot them a little.
+func (g *Group) checkLimits(ns string, entry raft.LogEntry) error {
+	limits := g.config.Limits
+	var growth int64
+	ops := entryOps(entry)
+	for _, op := range ops {
+		if limits.MaxKeyBytes > 0 && len(userKey(op.Key)) > limits.MaxKeyBytes {
+			return ErrKeyTooLarge
+		}
+		if limits.MaxValueBytes > 0 {
+			if op.Value != nil && len(*op.Value) > limits.MaxValueBytes ||
+				op.CompareValue != nil && len(*op.CompareValue) > limits.MaxValueBytes {
+				return ErrValueTooLarge
+			}
+		}
+		if op.Value != nil {
+			growth += int64(len(op.Key)+len(*op.Value)) - int64(g.storage.Size(op.Key))
+		}
+	}
+	if limits.MaxTotalBytes > 0 && growth > 0 && g.storage.Usage().Bytes+growth > limits.MaxTotalBytes {
+		return ErrQuotaExceeded
+	}
+	return g.checkNamespaceQuota(ns, ops)
+}
+
+// bodyLimit rejects requests whose body is longer than limit bytes.
+func bodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return errorResponse(c, ErrRequestTooLarge)
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+			return next(c)
+		}
+	}
+}
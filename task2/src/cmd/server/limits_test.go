@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"raft/pkg/config"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestChunkedBodyOverLimitIsTooLarge(t *testing.T) {
+	s := &Server{config: &config.Config{}}
+	e := echo.New()
+	e.POST("/api/create", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, bodyLimit(16), s.routeBy(true, requestKey))
+
+	body := `{"key":"k","value":"` + strings.Repeat("v", 64) + `"}`
+	// Without a length the limit is only hit while reading.
+	req := httptest.NewRequest(http.MethodPost, "/api/create", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status: got %d %s, want %d", rec.Code, rec.Body, http.StatusRequestEntityTooLarge)
+	}
+	var got limitError
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Code != "request_too_large" {
+		t.Fatalf("body: got %s, %v", rec.Body, err)
+	}
+}
+
+func TestLimitErrorsCarryCodes(t *testing.T) {
+	for err, want := range map[error]string{
+		ErrKeyTooLarge:   "key_too_large",
+		ErrValueTooLarge: "value_too_large",
+	} {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		if err := errorResponse(c, err); err != nil {
+			t.Fatal(err)
+		}
+		var got limitError
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusRequestEntityTooLarge || got.Code != want || got.Error != err.Error() {
+			t.Fatalf("%v: got %d %+v, want code %s", err, rec.Code, got, want)
+		}
+	}
+}
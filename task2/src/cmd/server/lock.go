@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const lockPollInterval = 50 * time.Millisecond
+
+type lockResponse struct {
+	Key string `json:"key"`
+	storage.LockState
+	TTL     int64 `json:"ttl_ms"`
+	GroupID int   `json:"group_id"`
+}
+
+func (g *Group) lockResponse(key string, state storage.LockState) lockResponse {
+	resp := lockResponse{
+		Key:       key,
+		LockState: state,
+		GroupID:   g.ID,
+	}
+	if lease, _, err := g.storage.Lease(state.Lease); err == nil {
+		resp.TTL = lease.TTL
+	}
+	return resp
+}
+
+// lockState reads where lease stands in the lock from the local replica.
+func (g *Group) lockState(key string, lease int) (storage.LockState, error) {
+	lock, ok := g.storage.Lock(key)
+	if !ok {
+		return storage.LockState{}, storage.ErrNotLockOwner
+	}
+	state, ok := lock.StateOf(lease)
+	if !ok {
+		return storage.LockState{}, storage.ErrNotLockOwner
+	}
+	return state, nil
+}
+
+// waitLock polls the leader's state until lease holds the lock, leaves the
+// queue (its lease ran out) or timeout passes.
+func (g *Group) waitLock(c echo.Context, key string, state storage.LockState, timeout time.Duration) (storage.LockState, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for !state.Acquired {
+		select {
+		case <-c.Request().Context().Done():
+			return state, c.Request().Context().Err()
+		case <-timer.C:
+			return state, nil
+		case <-ticker.C:
+		}
+		if !g.node.IsLeader() {
+			return state, raft.ErrNotLeader
+		}
+		var err error
+		if state, err = g.lockState(nsKey(c, key), state.Lease); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// AcquireLockRequestHandler takes the lock for a lease, granting a fresh one
+// when only ttl_ms is given, and queues it behind the current holder
+// otherwise. With wait_ms it blocks until the lock is acquired or the wait
+// runs out; the returned position says where the lease still waits.
+func (s *Server) AcquireLockRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Lease int    `json:"lease"`
+		TTL   int64  `json:"ttl_ms"`
+		Wait  int64  `json:"wait_ms"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.Lease == 0 {
+		if req.TTL <= 0 {
+			return c.JSON(http.StatusBadRequest, "lease or a positive ttl_ms is required")
+		}
+		result, err := g.propose(c, raft.LogEntry{
+			Command: raft.OpGrantLease,
+			TTL:     req.TTL,
+		})
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		req.Lease = result.(storage.Lease).ID
+	}
+
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpAcquireLock,
+		Key:     req.Key,
+		Lease:   req.Lease,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	state := result.(storage.LockState)
+	if req.Wait > 0 {
+		timeout := min(time.Duration(req.Wait)*time.Millisecond, longPollTimeout)
+		if state, err = g.waitLock(c, req.Key, state, timeout); err != nil {
+			return errorResponse(c, err)
+		}
+	}
+	return c.JSON(http.StatusOK, g.lockResponse(req.Key, state))
+}
+
+func (s *Server) ReleaseLockRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Lease int    `json:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entry := raft.LogEntry{
+		Command: raft.OpReleaseLock,
+		Key:     req.Key,
+		Lease:   req.Lease,
+	}
+	return g.replicate(c, entry)
+}
+
+// RefreshLockRequestHandler keeps the lease of a holder or waiter alive.
+func (s *Server) RefreshLockRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Key   string `json:"key"`
+		Lease int    `json:"lease"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if _, err := g.lockState(nsKey(c, req.Key), req.Lease); err != nil {
+		return errorResponse(c, err)
+	}
+	_, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpKeepAlive,
+		Lease:   req.Lease,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	state, err := g.lockState(nsKey(c, req.Key), req.Lease)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, g.lockResponse(req.Key, state))
+}
+
+func (s *Server) LockInfoRequestHandler(c echo.Context) error {
+	g := group(c)
+	if g.node.IsLeader() {
+		if err := g.statusCheck(c); err != nil {
+			return c.JSON(http.StatusServiceUnavailable, err.Error())
+		}
+	}
+
+	var req struct {
+		Key string `json:"key" query:"key"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	lock, ok := g.storage.Lock(nsKey(c, req.Key))
+	if !ok {
+		lock = storage.Lock{Waiters: []storage.LockOwner{}}
+	}
+	lock.Name = req.Key
+	return c.JSON(http.StatusOK, lock)
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"raft/pkg/config"
 	"raft/pkg/raft"
+	"syscall"
 )
 
 func main() {
@@ -16,10 +22,66 @@ func main() {
 	log.SetFlags(log.Ltime | log.Lshortfile)
 	log.SetPrefix(fmt.Sprintf("[RAFT] [%s] ", config.Name))
 
-	raft := raft.NewRaft(config)
-	if raft == nil {
-		log.Fatalln("Failed to create raft")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			if err := initCluster(config); err != nil {
+				log.Fatalf("Failed to init cluster: %s", err)
+			}
+			return
+		case "export":
+			if err := exportKeys(config, os.Args[2:]); err != nil {
+				log.Fatalf("Failed to export: %s", err)
+			}
+			return
+		case "import":
+			if err := importKeys(config, os.Args[2:]); err != nil {
+				log.Fatalf("Failed to import: %s", err)
+			}
+			return
+		}
+	}
+
+	transport := raft.NewHTTPTransport(config.ResponseTimeout, config.Addresses)
+	groups := make([]*Group, 0, len(config.Groups))
+	for _, gc := range config.Groups {
+		g, err := NewGroup(config, gc, transport)
+		if err != nil {
+			log.Fatalf("Failed to create raft: %s", err)
+		}
+		g.node.Start()
+		groups = append(groups, g)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := NewServer(config, transport, groups)
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.Start()
+	}()
+
+	select {
+	case err = <-failed:
+		log.Printf("Server failed: %s", err)
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ResponseTimeout)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server: %s", err)
+		}
+		cancel()
+		if err := <-failed; !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Server failed: %s", err)
+		}
+		err = nil
+	}
+
+	// Groups close only after the server, so no request reaches a closed storage.
+	for _, g := range groups {
+		g.Close()
+	}
+	if err != nil {
+		os.Exit(1)
 	}
-	err = raft.Start()
-	log.Fatalf("Server failed: %s", err)
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrNamespaceQuotaExceeded = errors.New("namespace quota exceeded")
+
+const namespaceHeader = "X-Namespace"
+
+// requestNamespace reads the namespace a client request is scoped to from
+// the X-Namespace header or the namespace query parameter; none means the
+// default namespace.
+func requestNamespace(c echo.Context) (string, error) {
+	ns := c.Request().Header.Get(namespaceHeader)
+	if ns == "" {
+		ns = c.QueryParam("namespace")
+	}
+	if ns == "" {
+		return "", nil
+	}
+	return ns, storage.ValidateNamespace(ns)
+}
+
+func namespace(c echo.Context) string {
+	ns, _ := c.Get("namespace").(string)
+	return ns
+}
+
+// nsKey returns the stored form of a key the client named.
+func nsKey(c echo.Context, key string) string {
+	return storage.NamespaceKey(namespace(c), key)
+}
+
+func userKey(key string) string {
+	_, key = storage.SplitKey(key)
+	return key
+}
+
+// scope moves every key of an entry into namespace ns.
+func scope(ns string, entry raft.LogEntry) raft.LogEntry {
+	if ns == "" {
+		return entry
+	}
+	scopeOps := func(ops []raft.TxnOp) []raft.TxnOp {
+		scoped := make([]raft.TxnOp, len(ops))
+		for i, op := range ops {
+			op.Key = storage.NamespaceKey(ns, op.Key)
+			scoped[i] = op
+		}
+		return scoped
+	}
+	if entry.Key != "" {
+		entry.Key = storage.NamespaceKey(ns, entry.Key)
+	}
+	if entry.Txn != nil {
+		txn := raft.Txn{
+			Compare: make([]raft.Compare, len(entry.Txn.Compare)),
+			Success: scopeOps(entry.Txn.Success),
+			Failure: scopeOps(entry.Txn.Failure),
+		}
+		for i, c := range entry.Txn.Compare {
+			c.Key = storage.NamespaceKey(ns, c.Key)
+			txn.Compare[i] = c
+		}
+		entry.Txn = &txn
+	}
+	if entry.Ops != nil {
+		entry.Ops = scopeOps(entry.Ops)
+	}
+	return entry
+}
+
+// checkNamespaceQuota refuses writes that would take namespace ns past its
+// max_keys or max_bytes. Like the group quota it is judged against applied
+// data.
+func (g *Group) checkNamespaceQuota(ns string, ops []raft.TxnOp) error {
+	if ns == "" {
+		return nil
+	}
+	namespace, usage, err := g.storage.Namespace(ns)
+	if err != nil {
+		return err
+	}
+	var keys int
+	var growth int64
+	for _, op := range ops {
+		if op.Value == nil {
+			continue
+		}
+		size := g.storage.Size(op.Key)
+		if size == 0 {
+			keys++
+		}
+		growth += int64(len(op.Key)+len(*op.Value)) - int64(size)
+	}
+	if namespace.MaxKeys > 0 && keys > 0 && usage.Keys+keys > namespace.MaxKeys ||
+		namespace.MaxBytes > 0 && growth > 0 && usage.Bytes+growth > namespace.MaxBytes {
+		return ErrNamespaceQuotaExceeded
+	}
+	return nil
+}
+
+// namespaceName places a namespace by its name, like a key.
+func namespaceName(body []byte) ([]string, error) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return []string{req.Name}, nil
+}
+
+type namespaceResponse struct {
+	storage.Namespace
+	GroupID int           `json:"group_id"`
+	Usage   storage.Usage `json:"usage"`
+}
+
+func (s *Server) CreateNamespaceRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req storage.Namespace
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := storage.ValidateNamespace(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.MaxKeys < 0 || req.MaxBytes < 0 {
+		return c.JSON(http.StatusBadRequest, "max_keys and max_bytes must not be negative")
+	}
+	_, err := g.propose(c, raft.LogEntry{
+		Command:   raft.OpCreateNamespace,
+		Namespace: req.Name,
+		MaxKeys:   req.MaxKeys,
+		MaxBytes:  req.MaxBytes,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, namespaceResponse{
+		Namespace: req,
+		GroupID:   g.ID,
+		Usage:     storage.Usage{},
+	})
+}
+
+// DropNamespaceRequestHandler deletes a namespace and all its keys in one
+// log entry, so no replica ever holds part of it.
+func (s *Server) DropNamespaceRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := storage.ValidateNamespace(req.Name); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entry := raft.LogEntry{
+		Command:   raft.OpDropNamespace,
+		Namespace: req.Name,
+	}
+	return g.replicate(c, entry)
+}
+
+// ListNamespacesRequestHandler lists the namespaces of every group on this
+// node with their usage, read from the local replicas.
+func (s *Server) ListNamespacesRequestHandler(c echo.Context) error {
+	namespaces := make([]namespaceResponse, 0)
+	for _, g := range s.groups {
+		for _, ns := range g.storage.Namespaces() {
+			_, usage, err := g.storage.Namespace(ns.Name)
+			if err != nil {
+				continue
+			}
+			namespaces = append(namespaces, namespaceResponse{
+				Namespace: ns,
+				GroupID:   g.ID,
+				Usage:     usage,
+			})
+		}
+	}
+	slices.SortFunc(namespaces, func(a, b namespaceResponse) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return c.JSON(http.StatusOK, struct {
+		Namespaces []namespaceResponse `json:"namespaces"`
+	}{
+		Namespaces: namespaces,
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"raft/pkg/config"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"strings"
+	"testing"
+)
+
+func TestNamespaceQuotas(t *testing.T) {
+	g := newTestGroup(t, config.GroupConfig{})
+	revision := g.storage.Revision() + 1
+	err := g.storage.Update(revision, 0, func(tx *storage.Tx) error {
+		return tx.CreateNamespace(storage.Namespace{Name: "team", MaxKeys: 2, MaxBytes: 40})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.storage.Commit(revision); err != nil {
+		t.Fatal(err)
+	}
+	// The key is its own value: 7 + 7 bytes.
+	key := func(name string) string { return storage.NamespaceKey("team", name) }
+	putKeys(t, g, key("a"))
+	set := func(name string, size int) raft.TxnOp {
+		value := strings.Repeat("v", size)
+		return raft.TxnOp{Key: key(name), Value: &value}
+	}
+
+	tests := []struct {
+		name string
+		ops  []raft.TxnOp
+		want error
+	}{
+		{"one new key", []raft.TxnOp{set("b", 1)}, nil},
+		{"too many keys", []raft.TxnOp{set("b", 1), set("c", 1)}, ErrNamespaceQuotaExceeded},
+		{"overwrite within bytes", []raft.TxnOp{set("a", 30)}, nil},
+		{"overwrite past bytes", []raft.TxnOp{set("a", 34)}, ErrNamespaceQuotaExceeded},
+		{"shrink", []raft.TxnOp{set("a", 1)}, nil},
+		{"delete", []raft.TxnOp{{Key: key("a")}, {Key: key("b")}, {Key: key("c")}}, nil},
+	}
+	for _, test := range tests {
+		entry := raft.LogEntry{Command: raft.OpBatch, Ops: test.ops}
+		if err := g.checkLimits("team", entry); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	if err := g.checkLimits("", raft.LogEntry{Command: raft.OpBatch, Ops: tests[1].ops}); err != nil {
+		t.Errorf("default namespace: got %v, want no quota", err)
+	}
+	if err := g.checkLimits("gone", raft.LogEntry{Command: raft.OpBatch}); !errors.Is(err, storage.ErrNamespaceNotFound) {
+		t.Errorf("missing namespace: got %v, want %v", err, storage.ErrNamespaceNotFound)
+	}
+}
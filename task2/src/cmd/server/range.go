@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"raft/pkg/storage"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RangeRequestHandler lists keys of every group on this node, or of the
+// one group holding the namespace the request is scoped to. Each group is
+// read like a point read: a leader waits until it is ready, a follower
+// answers from its local state.
+func (s *Server) RangeRequestHandler(c echo.Context) error {
+	var req struct {
+		Start     string `json:"start" query:"start"`
+		End       string `json:"end" query:"end"`
+		Prefix    string `json:"prefix" query:"prefix"`
+		Limit     int    `json:"limit" query:"limit"`
+		Reverse   bool   `json:"reverse" query:"reverse"`
+		KeysOnly  bool   `json:"keys_only" query:"keys_only"`
+		CountOnly bool   `json:"count_only" query:"count_only"`
+		Continue  string `json:"continue" query:"continue"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if req.Limit < 0 {
+		return c.JSON(http.StatusBadRequest, "limit must not be negative")
+	}
+	ns, err := requestNamespace(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	groups := s.groups
+	if ns != "" {
+		g, err := s.groupForKey(ns)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		if _, _, err := g.storage.Namespace(ns); err != nil {
+			return errorResponse(c, err)
+		}
+		groups = []*Group{g}
+	}
+	opts := storage.RangeOptions{
+		Start:     req.Start,
+		End:       req.End,
+		Prefix:    req.Prefix,
+		Limit:     req.Limit,
+		Reverse:   req.Reverse,
+		KeysOnly:  req.KeysOnly,
+		CountOnly: req.CountOnly,
+	}
+	if req.Continue != "" {
+		next, err := base64.RawURLEncoding.DecodeString(req.Continue)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "bad continue token")
+		}
+		if req.Reverse {
+			opts.End = string(next) + "\x00"
+		} else {
+			opts.Start = string(next)
+		}
+	}
+	if storage.IsReserved(opts.Start) || storage.IsReserved(opts.End) || storage.IsReserved(opts.Prefix) {
+		return c.JSON(http.StatusBadRequest, storage.ErrKeyReserved.Error())
+	}
+	if ns != "" {
+		opts.Namespace = ns
+		// Scoped bounds stay within the namespace through its prefix.
+		if opts.Start != "" {
+			opts.Start = storage.NamespaceKey(ns, opts.Start)
+		}
+		if opts.End != "" {
+			opts.End = storage.NamespaceKey(ns, opts.End)
+		}
+		opts.Prefix = storage.NamespaceKey(ns, opts.Prefix)
+	}
+
+	kvs := make([]storage.KeyValue, 0)
+	count := 0
+	more := false
+	var next string
+	for _, g := range groups {
+		if ns == "" && !s.overlaps(g, opts) {
+			continue
+		}
+		if g.node.IsLeader() {
+			if err := g.statusCheck(c); err != nil {
+				return c.JSON(http.StatusServiceUnavailable, err.Error())
+			}
+		}
+		result, err := g.storage.Range(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		kvs = append(kvs, result.KVs...)
+		count += result.Count
+		if result.More && (!more || before(result.Next, next, req.Reverse)) {
+			more = true
+			next = result.Next
+		}
+	}
+
+	slices.SortFunc(kvs, func(a, b storage.KeyValue) int {
+		if req.Reverse {
+			return strings.Compare(b.Key, a.Key)
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	// A group that stopped at next may hold unreturned keys before the
+	// keys other groups returned past it.
+	if more {
+		kvs = slices.DeleteFunc(kvs, func(kv storage.KeyValue) bool {
+			return !before(kv.Key, next, req.Reverse)
+		})
+	}
+	if req.Limit > 0 && len(kvs) > req.Limit {
+		more = true
+		next = kvs[req.Limit].Key
+		kvs = kvs[:req.Limit]
+	}
+
+	for i := range kvs {
+		kvs[i].Key = userKey(kvs[i].Key)
+	}
+	token := ""
+	if more {
+		token = base64.RawURLEncoding.EncodeToString([]byte(userKey(next)))
+	}
+	return c.JSON(http.StatusOK, struct {
+		KVs      []storage.KeyValue `json:"kvs"`
+		Count    int                `json:"count"`
+		More     bool               `json:"more"`
+		Continue string             `json:"continue,omitempty"`
+	}{
+		KVs:      kvs,
+		Count:    count,
+		More:     more,
+		Continue: token,
+	})
+}
+
+func before(a, b string, reverse bool) bool {
+	if reverse {
+		return a > b
+	}
+	return a < b
+}
+
+// overlaps reports whether a range-sharded group can hold keys of opts.
+func (s *Server) overlaps(g *Group, opts storage.RangeOptions) bool {
+	if s.config.Sharding != "range" {
+		return true
+	}
+	start, end := opts.Bounds()
+	return (g.End == "" || start < g.End) && (end == "" || g.Start < end)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"raft/pkg/config"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type rangePage struct {
+	KVs []struct {
+		Key string `json:"key"`
+	} `json:"kvs"`
+	Count    int    `json:"count"`
+	More     bool   `json:"more"`
+	Continue string `json:"continue"`
+}
+
+func getRange(t *testing.T, s *Server, query url.Values) rangePage {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/range?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	if err := s.RangeRequestHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("range %s: got %d %s", query.Encode(), rec.Code, rec.Body)
+	}
+	var page rangePage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestRangePagesAcrossGroups(t *testing.T) {
+	low := newTestGroup(t, config.GroupConfig{ID: 0, End: "m"})
+	high := newTestGroup(t, config.GroupConfig{ID: 1, Start: "m"})
+	putKeys(t, low, "a", "b", "c")
+	putKeys(t, high, "m", "n", "o")
+	s := &Server{config: &config.Config{Sharding: "range"}, groups: []*Group{low, high}}
+
+	for _, reverse := range []bool{false, true} {
+		want := [][]string{{"a", "b"}, {"c", "m"}, {"n", "o"}}
+		if reverse {
+			want = [][]string{{"o", "n"}, {"m", "c"}, {"b", "a"}}
+		}
+		query := url.Values{"limit": {"2"}, "reverse": {strconv.FormatBool(reverse)}}
+		for i, keys := range want {
+			page := getRange(t, s, query)
+			if i == 0 && page.Count != 6 {
+				t.Fatalf("count: got %d, want 6", page.Count)
+			}
+			if len(page.KVs) != len(keys) || page.KVs[0].Key != keys[0] || page.KVs[1].Key != keys[1] {
+				t.Fatalf("reverse %v page %d: got %+v, want %v", reverse, i, page.KVs, keys)
+			}
+			if last := i == len(want)-1; page.More == last || (page.Continue == "") != last {
+				t.Fatalf("reverse %v page %d: more %v, continue %q", reverse, i, page.More, page.Continue)
+			}
+			query.Set("continue", page.Continue)
+		}
+	}
+
+	// Bounds and prefixes narrow the pages the same way.
+	page := getRange(t, s, url.Values{"start": {"b"}, "end": {"n"}, "limit": {"2"}})
+	if page.Count != 3 || len(page.KVs) != 2 || page.KVs[0].Key != "b" || !page.More {
+		t.Fatalf("bounded range: got %+v", page)
+	}
+	page = getRange(t, s, url.Values{"start": {"b"}, "end": {"n"}, "continue": {page.Continue}})
+	if len(page.KVs) != 1 || page.KVs[0].Key != "m" || page.More {
+		t.Fatalf("bounded range, second page: got %+v", page)
+	}
+	if page := getRange(t, s, url.Values{"prefix": {"n"}}); page.Count != 1 || page.KVs[0].Key != "n" {
+		t.Fatalf("prefix range: got %+v", page)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/range?continue=%25%25", nil)
+	if err := s.RangeRequestHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad continue token: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+const forwardedHeader = "X-Raft-Forwarded"
+
+// keysFunc extracts the keys a request touches from its body.
+type keysFunc func(body []byte) ([]string, error)
+
+func requestKey(body []byte) ([]string, error) {
+	var target struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &target); err != nil {
+		return nil, err
+	}
+	return []string{target.Key}, nil
+}
+
+// route picks the group owning the request key (or the explicit group_id),
+// read from the JSON body or, for bodiless and raw-value requests, the query
+// string, and, for leaderOnly endpoints, proxies the request to that group's
+// leader. Requests scoped to a namespace go to the group owning its name.
+// Witnesses hold no data, so they proxy every request.
+func (s *Server) route(leaderOnly bool) echo.MiddlewareFunc {
+	return s.routeBy(leaderOnly, requestKey)
+}
+
+// routeBy is route for requests whose keys must all live in one group.
+func (s *Server) routeBy(leaderOnly bool, keysOf keysFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return readError(c, err)
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			ns, err := requestNamespace(c)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, err.Error())
+			}
+			c.Set("namespace", ns)
+
+			var target struct {
+				GroupID  *int `json:"group_id" query:"group_id"`
+				ClientID int  `json:"client_id" query:"client_id"`
+				Lease    int  `json:"lease" query:"lease"`
+			}
+			keys := []string{c.QueryParam("key")}
+			if len(body) > 0 && !isRawBody(c) {
+				if err := json.Unmarshal(body, &target); err != nil {
+					return c.JSON(http.StatusBadRequest, err.Error())
+				}
+				if keys, err = keysOf(body); err != nil {
+					return c.JSON(http.StatusBadRequest, err.Error())
+				}
+			} else if err := (&echo.DefaultBinder{}).BindQueryParams(c, &target); err != nil {
+				return c.JSON(http.StatusBadRequest, err.Error())
+			}
+
+			for _, key := range keys {
+				if storage.IsReserved(key) {
+					return c.JSON(http.StatusBadRequest, storage.ErrKeyReserved.Error())
+				}
+			}
+
+			var g *Group
+			switch {
+			case ns != "":
+				g, err = s.groupForKey(ns)
+			case target.GroupID != nil:
+				g, err = s.groupByID(*target.GroupID)
+			case target.Lease != 0 && !slices.ContainsFunc(keys, func(key string) bool { return key != "" }):
+				// Requests on a lease alone go to the group that granted it.
+				g, err = s.groupByID(raft.IDGroup(target.Lease))
+			default:
+				g, err = s.groupForKeys(keys)
+			}
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, err.Error())
+			}
+			// Sessions and leases only exist in the group that made them.
+			if target.ClientID != 0 && raft.IDGroup(target.ClientID) != g.ID {
+				return c.JSON(http.StatusBadRequest, ErrForeignSession.Error())
+			}
+			if target.Lease != 0 && raft.IDGroup(target.Lease) != g.ID {
+				return c.JSON(http.StatusBadRequest, ErrForeignLease.Error())
+			}
+			c.Set("group", g)
+
+			if !leaderOnly && !s.config.Witness || g.node.IsLeader() {
+				if _, _, err := g.storage.Namespace(ns); err != nil {
+					return errorResponse(c, err)
+				}
+				return next(c)
+			}
+			return s.forwardToLeader(c, g)
+		}
+	}
+}
+
+// forwardWitness is the witness routing of requests that read every group
+// on the node: a witness has nothing to read, so it proxies them to the
+// leader of its first group.
+func (s *Server) forwardWitness(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.config.Witness {
+			return s.forwardToLeader(c, s.groups[0])
+		}
+		return next(c)
+	}
+}
+
+// forwardToLeader proxies the request to the leader of g. A request is
+// forwarded only once, so nodes with stale views of the leader cannot
+// bounce it between them.
+func (s *Server) forwardToLeader(c echo.Context, g *Group) error {
+	leader := g.node.Leader()
+	if leader == "" || c.Request().Header.Get(forwardedHeader) != "" {
+		return c.JSON(http.StatusServiceUnavailable, raft.ErrNotLeader.Error())
+	}
+	return s.forward(c, leader)
+}
+
+// postToLeader sends body to path on the leader of g, as a part of the
+// request being served, and decodes the JSON response into out. Error
+// responses come back as *echo.HTTPError with the leader's status.
+func (s *Server) postToLeader(c echo.Context, g *Group, path, contentType string, body []byte, out any) error {
+	leader := g.node.Leader()
+	if leader == "" || c.Request().Header.Get(forwardedHeader) != "" {
+		return raft.ErrNotLeader
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), s.config.ResponseTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.transport.Address(leader)+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, contentType)
+	req.Header.Set(forwardedHeader, "1")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// The leader answers with a message or, for limits, a limitError.
+		message := res.Status
+		var text string
+		var limit limitError
+		data, _ := io.ReadAll(res.Body)
+		if json.Unmarshal(data, &text) == nil {
+			message = text
+		} else if json.Unmarshal(data, &limit) == nil && limit.Error != "" {
+			message = limit.Error
+		}
+		return echo.NewHTTPError(res.StatusCode, fmt.Sprintf("group %d: %s", g.ID, message))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (s *Server) forward(c echo.Context, leader string) error {
+	target, err := url.Parse(s.transport.Address(leader))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	c.Request().Header.Set(forwardedHeader, "1")
+	httputil.NewSingleHostReverseProxy(target).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
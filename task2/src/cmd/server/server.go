@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"raft/pkg/config"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Server struct {
+	config    *config.Config
+	transport *raft.HTTPTransport
+	groups    []*Group
+	http      *http.Server
+}
+
+func NewServer(config *config.Config, transport *raft.HTTPTransport, groups []*Group) *Server {
+	return &Server{
+		config:    config,
+		transport: transport,
+		groups:    groups,
+		http: &http.Server{
+			Addr:           config.ListenAddr,
+			ReadTimeout:    30 * time.Second,
+			WriteTimeout:   30 * time.Second,
+			MaxHeaderBytes: 1 << 20,
+		},
+	}
+}
+
+func (s *Server) Start() error {
+	e := echo.New()
+
+	leader := s.route(true)
+	local := s.route(false)
+
+	client := e.Group("/api")
+	if limit := s.config.Limits.MaxRequestBytes; limit > 0 {
+		client.Use(bodyLimit(limit))
+	}
+	client.POST("/create", s.CreateRequestHandler, leader)
+	client.GET("/read", s.ReadRequestHandler, local)
+	client.GET("/watch", s.WatchRequestHandler, local)
+	client.GET("/range", s.RangeRequestHandler, s.forwardWitness)
+	client.POST("/update", s.UpdateRequestHandler, leader)
+	client.POST("/delete", s.DeleteRequestHandler, leader)
+	client.POST("/cas", s.CASRequestHandler, leader)
+	client.POST("/increment", s.IncrementRequestHandler, leader)
+	client.POST("/decrement", s.DecrementRequestHandler, leader)
+	client.POST("/txn", s.TxnRequestHandler, s.routeBy(true, txnKeys))
+	client.POST("/batch", s.BatchRequestHandler)
+	client.POST("/lease/grant", s.GrantLeaseRequestHandler, leader)
+	client.POST("/lease/keepalive", s.KeepAliveRequestHandler, leader)
+	client.POST("/lease/revoke", s.RevokeLeaseRequestHandler, leader)
+	client.GET("/lease", s.LeaseInfoRequestHandler, local)
+	client.POST("/lock/acquire", s.AcquireLockRequestHandler, leader)
+	client.POST("/lock/release", s.ReleaseLockRequestHandler, leader)
+	client.POST("/lock/refresh", s.RefreshLockRequestHandler, leader)
+	client.GET("/lock", s.LockInfoRequestHandler, local)
+	client.POST("/compact", s.CompactRequestHandler, leader)
+	client.GET("/get_replicas", s.GetReplicasRequestHandler, leader)
+	client.POST("/register_client", s.RegisterClientRequestHandler, leader)
+	client.GET("/status", s.StatusRequestHandler)
+
+	// Import bodies become single entries, so they share the request limit.
+	admin := e.Group("/admin")
+	if limit := s.config.Limits.MaxRequestBytes; limit > 0 {
+		admin.Use(bodyLimit(limit))
+	}
+	admin.POST("/init", s.InitRequestHandler)
+	admin.POST("/namespace/create", s.CreateNamespaceRequestHandler, s.routeBy(true, namespaceName))
+	admin.POST("/namespace/drop", s.DropNamespaceRequestHandler, s.routeBy(true, namespaceName))
+	admin.GET("/namespaces", s.ListNamespacesRequestHandler, s.forwardWitness)
+	admin.GET("/export", s.ExportRequestHandler, s.forwardWitness)
+	admin.POST("/import", s.ImportRequestHandler)
+
+	raft := e.Group("/raft")
+	raft.POST("/request_vote", s.RequestVoteRequestHandler)
+	raft.POST("/add_log", s.AddLogRequestHandler)
+	raft.POST("/add_log_batch", s.AddLogBatchRequestHandler)
+	raft.POST("/timeout_now", s.TimeoutNowRequestHandler)
+
+	for _, g := range s.groups {
+		go g.ExpireSessions()
+		go g.ExpireKeys()
+	}
+
+	return e.StartServer(s.http)
+}
+
+// Shutdown stops accepting requests and waits for the running ones, after
+// which Start returns http.ErrServerClosed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+func (s *Server) RequestVoteRequestHandler(c echo.Context) error {
+	var request raft.RequestVoteRequest
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+	g, err := s.groupByID(request.GroupID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, g.node.HandleRequestVote(request))
+}
+
+func (s *Server) AddLogRequestHandler(c echo.Context) error {
+	var request raft.AppendEntriesRequest
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+	g, err := s.groupByID(request.GroupID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, g.node.HandleAppendEntries(request))
+}
+
+func (s *Server) AddLogBatchRequestHandler(c echo.Context) error {
+	var requests []raft.AppendEntriesRequest
+	if err := c.Bind(&requests); err != nil {
+		return err
+	}
+	responses := make([]raft.AppendEntriesResponse, len(requests))
+	for i, request := range requests {
+		// Requests of other groups in the batch still get through.
+		g, err := s.groupByID(request.GroupID)
+		if err != nil {
+			responses[i] = raft.AppendEntriesResponse{Error: err.Error()}
+			continue
+		}
+		responses[i] = g.node.HandleAppendEntries(request)
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+func (s *Server) TimeoutNowRequestHandler(c echo.Context) error {
+	var request raft.TimeoutNowRequest
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+	g, err := s.groupByID(request.GroupID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, g.node.HandleTimeoutNow(request))
+}
+
+func (s *Server) StatusRequestHandler(c echo.Context) error {
+	type groupStatus struct {
+		raft.MetaInfo
+		GroupID   int           `json:"group_id"`
+		Start     string        `json:"start,omitempty"`
+		End       string        `json:"end,omitempty"`
+		Revision  int           `json:"revision"`
+		Compacted int           `json:"compacted_revision"`
+		Usage     storage.Usage `json:"usage"`
+	}
+	groups := make([]groupStatus, len(s.groups))
+	for i, g := range s.groups {
+		groups[i] = groupStatus{
+			MetaInfo:  g.node.MetaInfo(),
+			GroupID:   g.ID,
+			Start:     g.Start,
+			End:       g.End,
+			Revision:  g.storage.Revision(),
+			Compacted: g.storage.CompactedRevision(),
+			Usage:     g.storage.Usage(),
+		}
+	}
+	return c.JSON(http.StatusOK, struct {
+		Sharding string        `json:"sharding"`
+		Groups   []groupStatus `json:"groups"`
+		Limits   config.Limits `json:"limits"`
+	}{
+		Sharding: s.config.Sharding,
+		Groups:   groups,
+		Limits:   s.config.Limits,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"raft/pkg/config"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+	"time"
+)
+
+// newTestGroup returns a group whose raft node is not started, so it
+// serves reads as a follower.
+func newTestGroup(t *testing.T, gc config.GroupConfig) *Group {
+	t.Helper()
+	s, err := storage.NewStorage(storage.NewMemoryEngine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, err := kv.NewStateMachine(s, gc.ID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := raft.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	c := &config.Config{ID: "a", Sharding: "range"}
+	node, err := raft.NewRaft(c, nil, fsm, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Group{GroupConfig: gc, config: c, node: node, store: store, storage: s}
+}
+
+// putKeys writes each key with itself as the value, one revision per key.
+func putKeys(t *testing.T, g *Group, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		revision := g.storage.Revision() + 1
+		err := g.storage.Update(revision, 0, func(tx *storage.Tx) error {
+			return tx.Put(key, key, storage.WriteOptions{})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.storage.Commit(revision); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"raft/pkg/raft"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Session struct {
+	ClientID int `json:"client_id" query:"client_id"`
+	Sequence int `json:"sequence" query:"sequence"`
+}
+
+// RegisterClientRequestHandler opens a session with the group owning key
+// or group_id. Its client_id carries that group and is only valid there.
+func (s *Server) RegisterClientRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	result, err := g.propose(c, raft.LogEntry{
+		Command: raft.OpRegisterClient,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		ClientID int `json:"client_id"`
+		GroupID  int `json:"group_id"`
+	}{
+		ClientID: result.(int),
+		GroupID:  g.ID,
+	})
+}
+
+func (g *Group) ExpireSessions() {
+	if g.config.SessionTimeout <= 0 {
+		return
+	}
+	for {
+		time.Sleep(g.config.SessionTimeout / 2)
+		ctx, cancel := context.WithTimeout(context.Background(), g.config.ResponseTimeout)
+		if err := g.node.WaitReady(ctx); err != nil {
+			cancel()
+			continue
+		}
+		_, err := g.node.Replicate(ctx, raft.LogEntry{
+			Command: raft.OpExpireSessions,
+		})
+		cancel()
+		if err != nil {
+			log.Printf("Failed to expire sessions of group %d: %v", g.ID, err)
+		}
+	}
+}
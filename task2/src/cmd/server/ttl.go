@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"raft/pkg/raft"
+	"time"
+)
+
+const (
+	expireInterval = 200 * time.Millisecond
+	expireBatch    = 256
+)
+
+// ExpireKeys has the leader delete keys and leases that ran out through the
+// log, so every replica removes them at the same index.
+func (g *Group) ExpireKeys() {
+	for {
+		time.Sleep(expireInterval)
+		if !g.node.IsLeader() {
+			continue
+		}
+		now := time.Now().UnixMilli()
+		if keys := g.storage.ExpiredKeys(now, expireBatch); len(keys) > 0 {
+			g.expire(raft.LogEntry{
+				Command: raft.OpExpireKeys,
+				Keys:    keys,
+			})
+		}
+		if leases := g.storage.ExpiredLeases(now, expireBatch); len(leases) > 0 {
+			g.expire(raft.LogEntry{
+				Command: raft.OpExpireLeases,
+				Leases:  leases,
+			})
+		}
+	}
+}
+
+func (g *Group) expire(entry raft.LogEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.config.ResponseTimeout)
+	defer cancel()
+
+	if err := g.node.WaitReady(ctx); err != nil {
+		return
+	}
+	if _, err := g.node.Replicate(ctx, entry); err != nil {
+		log.Printf("Failed to expire keys of group %d: %v", g.ID, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"raft/pkg/kv"
+	"raft/pkg/raft"
+
+	"github.com/labstack/echo/v4"
+)
+
+var txnOps = map[string]raft.OpCode{
+	"get":    raft.OpGet,
+	"read":   raft.OpGet,
+	"create": raft.OpCreate,
+	"update": raft.OpSet,
+	"cas":    raft.OpCAS,
+	"delete": raft.OpDelete,
+}
+
+type txnOp struct {
+	Op                 string  `json:"op"`
+	Key                string  `json:"key"`
+	Value              *string `json:"value"`
+	ValueBase64        []byte  `json:"value_base64"`
+	CompareValue       *string `json:"compare_value"`
+	CompareValueBase64 []byte  `json:"compare_value_base64"`
+	ContentType        string  `json:"content_type"`
+	TTL                int64   `json:"ttl_ms"`
+	Lease              int     `json:"lease"`
+}
+
+type txnRequest struct {
+	Session
+	Compare []raft.Compare `json:"compare"`
+	Success []txnOp        `json:"success"`
+	Failure []txnOp        `json:"failure"`
+}
+
+func txnKeys(body []byte) ([]string, error) {
+	var req txnRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for _, c := range req.Compare {
+		keys = append(keys, c.Key)
+	}
+	for _, op := range append(req.Success, req.Failure...) {
+		keys = append(keys, op.Key)
+	}
+	return keys, nil
+}
+
+func convertOps(ops []txnOp) ([]raft.TxnOp, error) {
+	converted := make([]raft.TxnOp, len(ops))
+	for i, op := range ops {
+		command, ok := txnOps[op.Op]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown op %q", kv.ErrBadTxn, op.Op)
+		}
+		converted[i] = raft.TxnOp{
+			Command:      command,
+			Key:          op.Key,
+			Value:        jsonValue(op.Value, op.ValueBase64),
+			CompareValue: jsonValue(op.CompareValue, op.CompareValueBase64),
+			ContentType:  op.ContentType,
+			TTL:          op.TTL,
+			Lease:        op.Lease,
+		}
+	}
+	return converted, nil
+}
+
+func (s *Server) TxnRequestHandler(c echo.Context) error {
+	g := group(c)
+	if err := g.statusCheck(c); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
+	}
+
+	var req txnRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	success, err := convertOps(req.Success)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	failure, err := convertOps(req.Failure)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	txn := &raft.Txn{
+		Compare: req.Compare,
+		Success: success,
+		Failure: failure,
+	}
+	if err := kv.ValidateTxn(txn); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := g.propose(c, raft.LogEntry{
+		Command:  raft.OpTxn,
+		ClientID: req.ClientID,
+		Sequence: req.Sequence,
+		Txn:      txn,
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"raft/pkg/jsonvalue"
+	"raft/pkg/storage"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// isRawBody tells a value sent as the raw request body, in any content type
+// but JSON or a form, from a JSON request.
+func isRawBody(c echo.Context) bool {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	return contentType != "" &&
+		!strings.HasPrefix(contentType, echo.MIMEApplicationJSON) &&
+		!strings.HasPrefix(contentType, echo.MIMEApplicationForm) &&
+		!strings.HasPrefix(contentType, echo.MIMEMultipartForm)
+}
+
+// Payload is the value of a write: a JSON string in value, arbitrary bytes
+// in value_base64, or the whole body of a raw request.
+type Payload struct {
+	Value       *string `json:"value"`
+	ValueBase64 []byte  `json:"value_base64"`
+	ContentType string  `json:"content_type"`
+}
+
+// jsonValue picks the value of a JSON request sent as text or base64.
+func jsonValue(value *string, binary []byte) *string {
+	if binary != nil {
+		decoded := string(binary)
+		return &decoded
+	}
+	return value
+}
+
+func (p *Payload) value() string {
+	if value := jsonValue(p.Value, p.ValueBase64); value != nil {
+		return *value
+	}
+	return ""
+}
+
+// bindPayload binds a write request. A raw body becomes the value, with its
+// content type, and the other fields are taken from the query string.
+func bindPayload(c echo.Context, req any, payload *Payload) error {
+	if !isRawBody(c) {
+		return c.Bind(req)
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, req); err != nil {
+		return err
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	value := string(body)
+	payload.Value = &value
+	payload.ValueBase64 = nil
+	payload.ContentType = c.Request().Header.Get(echo.HeaderContentType)
+	return nil
+}
+
+// acceptsRaw reports whether the client asked for the bare value rather
+// than JSON: its Accept header names neither JSON nor any type.
+func acceptsRaw(c echo.Context) bool {
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	return accept != "" &&
+		!strings.Contains(accept, echo.MIMEApplicationJSON) &&
+		!strings.Contains(accept, "*/*")
+}
+
+func rawValue(c echo.Context, version storage.Version) error {
+	contentType := version.ContentType
+	if contentType == "" {
+		contentType = echo.MIMETextPlainCharsetUTF8
+		if _, binary := jsonvalue.Encode(version.Value); binary != nil {
+			contentType = echo.MIMEOctetStream
+		}
+	}
+	c.Response().Header().Set("X-Revision", strconv.Itoa(version.Revision))
+	return c.Blob(http.StatusOK, contentType, []byte(version.Value))
+}
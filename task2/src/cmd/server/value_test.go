@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"raft/pkg/config"
+	"raft/pkg/storage"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBinaryValueRoundTrip(t *testing.T) {
+	g := newTestGroup(t, config.GroupConfig{})
+	value := "\xff\x00\xfe png"
+
+	// A raw body is taken as is, with its content type.
+	req := httptest.NewRequest(http.MethodPost, "/api/create?key=img", strings.NewReader(value))
+	req.Header.Set(echo.HeaderContentType, "image/png")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	var body struct {
+		Key string `query:"key"`
+		Payload
+	}
+	if err := bindPayload(c, &body, &body.Payload); err != nil {
+		t.Fatal(err)
+	}
+	if body.Key != "img" || body.value() != value || body.ContentType != "image/png" {
+		t.Fatalf("bound %+v", body)
+	}
+	revision := g.storage.Revision() + 1
+	err := g.storage.Update(revision, 0, func(tx *storage.Tx) error {
+		return tx.Create(body.Key, body.value(), storage.WriteOptions{ContentType: body.ContentType})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.storage.Commit(revision); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/read?key=img", nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("group", g)
+		c.Set("namespace", "")
+		if err := (&Server{}).ReadRequestHandler(c); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("read: got %d %s", rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	var got struct {
+		Value       string `json:"value"`
+		ValueBase64 []byte `json:"value_base64"`
+		ContentType string `json:"content_type"`
+	}
+	rec := read("")
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != "" || string(got.ValueBase64) != value || got.ContentType != "image/png" {
+		t.Fatalf("json read: got %s", rec.Body)
+	}
+
+	rec = read("image/png")
+	if !bytes.Equal(rec.Body.Bytes(), []byte(value)) || rec.Header().Get(echo.HeaderContentType) != "image/png" {
+		t.Fatalf("raw read: got %q as %s", rec.Body, rec.Header().Get(echo.HeaderContentType))
+	}
+}
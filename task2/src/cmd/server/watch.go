@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"raft/pkg/storage"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	longPollTimeout  = 25 * time.Second
+	sseKeepAliveTick = 15 * time.Second
+)
+
+// WatchRequestHandler streams changes of a key or prefix as Server-Sent
+// Events when the client accepts text/event-stream and long-polls otherwise.
+// Both resume from revision, so a client that passes the revision after the
+// last event it saw misses nothing across reconnects.
+func (s *Server) WatchRequestHandler(c echo.Context) error {
+	g := group(c)
+
+	var req struct {
+		Key      string `json:"key" query:"key"`
+		Prefix   bool   `json:"prefix" query:"prefix"`
+		Revision int    `json:"revision" query:"revision"`
+		Timeout  int    `json:"timeout" query:"timeout"`
+		GroupID  *int   `json:"group_id" query:"group_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if id := c.Request().Header.Get("Last-Event-ID"); id != "" && req.Revision == 0 {
+		last, err := strconv.Atoi(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "bad Last-Event-ID")
+		}
+		req.Revision = last + 1
+	}
+
+	// Revisions are counted per group, so one watch can not follow the
+	// keys of several. A namespace lives in one group.
+	if req.Prefix && namespace(c) == "" && req.GroupID == nil && !s.holdsPrefix(g, req.Key) {
+		return c.JSON(http.StatusBadRequest, ErrPrefixSpans.Error())
+	}
+
+	w, err := g.storage.Watch(nsKey(c, req.Key), req.Prefix, req.Revision)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	defer g.storage.CancelWatch(w)
+
+	if c.Request().Header.Get(echo.HeaderAccept) == "text/event-stream" {
+		return streamEvents(c, w)
+	}
+	timeout := longPollTimeout
+	if req.Timeout > 0 {
+		timeout = min(time.Duration(req.Timeout)*time.Millisecond, longPollTimeout)
+	}
+	return pollEvents(c, g, w, req.Revision, timeout)
+}
+
+func streamEvents(c echo.Context, w *storage.Watcher) error {
+	res := c.Response()
+	// Streams outlive the server write timeout.
+	if err := http.NewResponseController(res.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ticker := time.NewTicker(sseKeepAliveTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			fmt.Fprint(res, ": keep-alive\n\n")
+		case event, ok := <-w.Events():
+			if !ok {
+				if w.Err() != nil {
+					fmt.Fprintf(res, "event: error\ndata: %q\n\n", w.Err().Error())
+					res.Flush()
+				}
+				return nil
+			}
+			event.Key = userKey(event.Key)
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.Revision, event.Type, data)
+		}
+		res.Flush()
+	}
+}
+
+func pollEvents(c echo.Context, g *Group, w *storage.Watcher, revision int, timeout time.Duration) error {
+	events := make([]storage.Event, 0)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.Request().Context().Done():
+		return nil
+	case <-timer.C:
+	case event, ok := <-w.Events():
+		if ok {
+			event.Key = userKey(event.Key)
+			events = append(events, event)
+		}
+	}
+
+	// Everything up to current was published before the drain below.
+	current := g.storage.Revision()
+drain:
+	for {
+		select {
+		case event, ok := <-w.Events():
+			if !ok {
+				break drain
+			}
+			event.Key = userKey(event.Key)
+			events = append(events, event)
+		default:
+			break drain
+		}
+	}
+
+	next := revision
+	if w.Err() == nil {
+		next = max(next, current+1)
+	}
+	if len(events) > 0 {
+		next = max(next, events[len(events)-1].Revision+1)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Events       []storage.Event `json:"events"`
+		NextRevision int             `json:"next_revision"`
+	}{
+		Events:       events,
+		NextRevision: next,
+	})
+}
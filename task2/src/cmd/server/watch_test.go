@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"raft/pkg/config"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestWatchRejectsPrefixesSpanningGroups(t *testing.T) {
+	low := newTestGroup(t, config.GroupConfig{ID: 0, End: "m"})
+	high := newTestGroup(t, config.GroupConfig{ID: 1, Start: "m"})
+	tests := []struct {
+		sharding string
+		query    string
+		group    *Group
+		want     int
+	}{
+		{"range", "key=a&prefix=true", low, http.StatusOK},
+		{"range", "key=&prefix=true", low, http.StatusBadRequest},
+		{"range", "key=l&prefix=true", low, http.StatusOK},
+		{"range", "key=n&prefix=true", high, http.StatusOK},
+		{"range", "key=&prefix=true&group_id=0", low, http.StatusOK},
+		{"range", "key=zzz", high, http.StatusOK},
+		{"hash", "key=a&prefix=true", low, http.StatusBadRequest},
+		{"hash", "key=a", low, http.StatusOK},
+	}
+	for _, test := range tests {
+		s := &Server{
+			config: &config.Config{Sharding: test.sharding},
+			groups: []*Group{low, high},
+		}
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/watch?timeout=1&"+test.query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("group", test.group)
+		c.Set("namespace", "")
+
+		if err := s.WatchRequestHandler(c); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != test.want {
+			t.Errorf("%s watch %q: got %d %s, want %d", test.sharding, test.query, rec.Code, rec.Body, test.want)
+		}
+	}
+}
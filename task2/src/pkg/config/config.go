@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/rand"
@@ -12,21 +15,72 @@ import (
 
 type Config struct {
 	Name       string
-	ServerPort int
-	OtherPorts []int
+	ID         string
+	ListenAddr string
+	Peers      []string
+	Addresses  map[string]string
+	Witness    bool
+	Witnesses  map[string]bool
+	Priorities map[string]int
 
 	LeaderHeartbeatDuration  time.Duration
 	FollowerHeartbeatWaiting time.Duration
 	ResponseTimeout          time.Duration
+	SessionTimeout           time.Duration
 
 	voteDurationMin int
 	voteDurationMax int
 
-	LeaderOnStart bool
+	DataDir string
+	Engine  string
+
+	Sharding string
+	Groups   []GroupConfig
+
+	Limits Limits
+}
+
+type NodeConfig struct {
+	ID       string `yaml:"id"`
+	Address  string `yaml:"address"`
+	Witness  bool   `yaml:"witness"`
+	Priority int    `yaml:"priority"`
+}
+
+// MaxGroupID bounds group IDs, which IDs handed out by a group embed.
+const MaxGroupID = 1<<16 - 1
+
+type GroupConfig struct {
+	ID    int    `yaml:"id"`
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// Limits bound what clients may write; zero means unlimited.
+type Limits struct {
+	MaxKeyBytes     int   `yaml:"max_key_bytes" json:"max_key_bytes"`
+	MaxValueBytes   int   `yaml:"max_value_bytes" json:"max_value_bytes"`
+	MaxRequestBytes int64 `yaml:"max_request_bytes" json:"max_request_bytes"`
+	// MaxTotalBytes caps the live keys and values of each group.
+	MaxTotalBytes int64 `yaml:"max_total_bytes" json:"max_total_bytes"`
+}
+
+var defaultLimits = Limits{
+	MaxKeyBytes:     4 << 10,
+	MaxValueBytes:   1 << 20,
+	MaxRequestBytes: 4 << 20,
+	MaxTotalBytes:   1 << 30,
 }
 
 type yamlConfig struct {
-	Ports []int `yaml:"ports"`
+	Nodes   []NodeConfig `yaml:"nodes"`
+	DataDir string       `yaml:"data_dir"`
+	Engine  string       `yaml:"engine"`
+
+	Sharding string        `yaml:"sharding"`
+	Groups   []GroupConfig `yaml:"groups"`
+
+	Limits Limits `yaml:"limits"`
 
 	VoteDuration struct {
 		Min int `yaml:"min"`
@@ -41,6 +95,7 @@ type yamlConfig struct {
 			LeaderHeartbeat int `yaml:"leader_heartbeat"`
 		} `yaml:"follower"`
 		Response int `yaml:"response"`
+		Session  int `yaml:"session"`
 	} `yaml:"timeout"`
 }
 
@@ -50,45 +105,116 @@ func NewConfig(hostsPath string) (*Config, error) {
 		return nil, err
 	}
 
-	var yc yamlConfig
+	// Limits left out of the file keep their defaults.
+	yc := yamlConfig{Limits: defaultLimits}
 	if err := yaml.Unmarshal(yamlData, &yc); err != nil {
 		return nil, err
 	}
 
-	portStr := os.Getenv("RAFT_PORT")
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return nil, err
-	}
 	name := os.Getenv("RAFT_NAME")
+	id := os.Getenv("RAFT_ID")
+	if id == "" {
+		id = name
+	}
 
-	otherPorts := make([]int, 0)
-	for _, p := range yc.Ports {
-		if p != port {
-			otherPorts = append(otherPorts, p)
+	peers := make([]string, 0)
+	addresses := make(map[string]string)
+	witnesses := make(map[string]bool)
+	priorities := make(map[string]int)
+	for _, n := range yc.Nodes {
+		if n.ID == "" || n.Address == "" {
+			return nil, fmt.Errorf("node %q must have id and address", n.ID)
+		}
+		if _, ok := addresses[n.ID]; ok {
+			return nil, fmt.Errorf("duplicate node id %q", n.ID)
+		}
+		addresses[n.ID] = n.Address
+		witnesses[n.ID] = n.Witness
+		priorities[n.ID] = n.Priority
+		if n.ID != id {
+			peers = append(peers, n.ID)
 		}
 	}
 
-	if len(otherPorts) == len(yc.Ports) {
-		return nil, fmt.Errorf("server port %d not found in ports", port)
+	self, ok := addresses[id]
+	if !ok {
+		return nil, fmt.Errorf("node id %q not found in nodes", id)
+	}
+	listenAddr := os.Getenv("RAFT_LISTEN")
+	if listenAddr == "" {
+		_, port, err := net.SplitHostPort(self)
+		if err != nil {
+			return nil, err
+		}
+		listenAddr = ":" + port
 	}
 
-	leaderOnStart := false
-	if _, ok := os.LookupEnv("RAFT_LEADER_ON_START"); ok {
-		leaderOnStart = true
+	groups := yc.Groups
+	if len(groups) == 0 {
+		groups = []GroupConfig{{ID: 0}}
+	}
+	seen := make(map[int]bool)
+	for _, g := range groups {
+		if seen[g.ID] {
+			return nil, fmt.Errorf("duplicate group id %d", g.ID)
+		}
+		if g.ID < 0 || g.ID > MaxGroupID {
+			return nil, fmt.Errorf("group id %d is not in 0..%d", g.ID, MaxGroupID)
+		}
+		seen[g.ID] = true
+	}
+	sharding := yc.Sharding
+	if sharding == "" {
+		sharding = "range"
+	}
+	if sharding != "range" && sharding != "hash" {
+		return nil, fmt.Errorf("unknown sharding %q", sharding)
+	}
+	if sharding == "range" {
+		if err := checkRanges(groups); err != nil {
+			return nil, err
+		}
+	}
+
+	dataDir := yc.DataDir
+	if dataDir == "" {
+		dataDir = "/app/data"
+	}
+
+	engine := yc.Engine
+	if engine == "" {
+		engine = "disk"
+	}
+	if engine != "disk" && engine != "memory" {
+		return nil, fmt.Errorf("unknown engine %q", engine)
+	}
+
+	limits := yc.Limits
+	if limits.MaxKeyBytes < 0 || limits.MaxValueBytes < 0 || limits.MaxRequestBytes < 0 || limits.MaxTotalBytes < 0 {
+		return nil, fmt.Errorf("limits must not be negative")
 	}
 
 	rand.Seed(uint64(time.Now().UnixNano()))
 	return &Config{
 		Name:                     name,
-		ServerPort:               port,
-		OtherPorts:               otherPorts,
+		ID:                       id,
+		ListenAddr:               listenAddr,
+		Peers:                    peers,
+		Addresses:                addresses,
+		Witness:                  witnesses[id],
+		Witnesses:                witnesses,
+		Priorities:               priorities,
 		voteDurationMin:          yc.VoteDuration.Min,
 		voteDurationMax:          yc.VoteDuration.Max,
 		LeaderHeartbeatDuration:  time.Duration(yc.Timeout.Leader.Heartbeat) * time.Millisecond,
 		FollowerHeartbeatWaiting: time.Duration(yc.Timeout.Follower.LeaderHeartbeat) * time.Millisecond,
 		ResponseTimeout:          time.Duration(yc.Timeout.Response) * time.Millisecond,
-		LeaderOnStart:            leaderOnStart,
+		SessionTimeout:           time.Duration(yc.Timeout.Session) * time.Millisecond,
+		DataDir:                  filepath.Join(dataDir, id),
+		Engine:                   engine,
+		Sharding:                 sharding,
+		Groups:                   groups,
+		Limits:                   limits,
 	}, nil
 }
 
@@ -96,3 +222,36 @@ func (c *Config) GetVoteDuration() time.Duration {
 	duration := rand.Intn(c.voteDurationMax-c.voteDurationMin+1) + c.voteDurationMin
 	return time.Duration(duration) * time.Millisecond
 }
+
+func (c *Config) Priority() int {
+	return c.Priorities[c.ID]
+}
+
+// checkRanges makes sure every key is owned by exactly one group: sorted by
+// start, each group begins where the one before ends, the first at "" and
+// the last unbounded.
+func checkRanges(groups []GroupConfig) error {
+	sorted := slices.Clone(groups)
+	slices.SortFunc(sorted, func(a, b GroupConfig) int {
+		return strings.Compare(a.Start, b.Start)
+	})
+	end := ""
+	for i, g := range sorted {
+		if g.End != "" && g.End <= g.Start {
+			return fmt.Errorf("group %d: end %q is not after start %q", g.ID, g.End, g.Start)
+		}
+		switch {
+		case i > 0 && end == "":
+			return fmt.Errorf("group %d starts at %q after group %d, which is unbounded", g.ID, g.Start, sorted[i-1].ID)
+		case g.Start < end:
+			return fmt.Errorf("group %d starts at %q inside group %d, which ends at %q", g.ID, g.Start, sorted[i-1].ID, end)
+		case g.Start > end:
+			return fmt.Errorf("no group owns keys from %q to %q", end, g.Start)
+		}
+		end = g.End
+	}
+	if end != "" {
+		return fmt.Errorf("no group owns keys from %q", end)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestCheckRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []GroupConfig
+		ok     bool
+	}{
+		{"single", []GroupConfig{{ID: 0}}, true},
+		{"split", []GroupConfig{{ID: 1, Start: "m"}, {ID: 0, End: "m"}}, true},
+		{"three", []GroupConfig{{ID: 0, End: "g"}, {ID: 1, Start: "g", End: "p"}, {ID: 2, Start: "p"}}, true},
+		{"gap", []GroupConfig{{ID: 0, End: "g"}, {ID: 1, Start: "h"}}, false},
+		{"overlap", []GroupConfig{{ID: 0, End: "m"}, {ID: 1, Start: "g"}}, false},
+		{"two unbounded", []GroupConfig{{ID: 0}, {ID: 1, Start: "m"}}, false},
+		{"no start", []GroupConfig{{ID: 0, Start: "a"}}, false},
+		{"no end", []GroupConfig{{ID: 0, End: "m"}}, false},
+		{"empty range", []GroupConfig{{ID: 0, End: "m"}, {ID: 1, Start: "m", End: "m"}, {ID: 2, Start: "m"}}, false},
+	}
+	for _, test := range tests {
+		if err := checkRanges(test.groups); (err == nil) != test.ok {
+			t.Errorf("%s: got %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
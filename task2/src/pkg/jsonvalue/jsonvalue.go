@@ -0,0 +1,66 @@
+// Package jsonvalue carries values, arbitrary bytes held in Go strings,
+// through JSON. JSON would replace bytes that are not valid UTF-8, so such
+// values travel base64-encoded in a sibling field instead.
+package jsonvalue
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Binary holds the base64-encoded sibling fields of the values of a type.
+type Binary struct {
+	ValueBase64        []byte `json:"value_base64,omitempty"`
+	CompareValueBase64 []byte `json:"compare_value_base64,omitempty"`
+}
+
+// Encode splits a value for JSON: text is returned as is, anything else as
+// raw bytes to be written base64-encoded.
+func Encode(value string) (string, []byte) {
+	if utf8.ValidString(value) {
+		return value, nil
+	}
+	return "", []byte(value)
+}
+
+// Marshal encodes plain, a struct without a MarshalJSON method, and adds
+// the fields of binary to the object.
+func Marshal(plain any, binary Binary) ([]byte, error) {
+	data, err := json.Marshal(plain)
+	if err != nil || binary.ValueBase64 == nil && binary.CompareValueBase64 == nil {
+		return data, err
+	}
+	extra, err := json.Marshal(binary)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 2 {
+		extra[0] = ','
+	} else {
+		extra = extra[1:]
+	}
+	return append(data[:len(data)-1], extra...), nil
+}
+
+// Unmarshal decodes data into plain, a pointer to a struct without an
+// UnmarshalJSON method, and returns the binary fields found next to it.
+func Unmarshal(data []byte, plain any) (Binary, error) {
+	var binary Binary
+	if err := json.Unmarshal(data, plain); err != nil {
+		return binary, err
+	}
+	if !bytes.Contains(data, []byte(`_base64"`)) {
+		return binary, nil
+	}
+	err := json.Unmarshal(data, &binary)
+	return binary, err
+}
+
+// Decode returns the value of a field and its binary sibling.
+func Decode(value string, binary []byte) string {
+	if binary != nil {
+		return string(binary)
+	}
+	return value
+}
@@ -0,0 +1,37 @@
+package jsonvalue
+
+import (
+	"testing"
+)
+
+type record struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, want := range []record{
+		{Key: "k", Value: "text"},
+		{Key: "k", Value: "\xff\x00bin"},
+		{Value: "\xfe"},
+		{},
+	} {
+		in := want
+		var binary Binary
+		in.Value, binary.ValueBase64 = Encode(in.Value)
+		data, err := Marshal(in, binary)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got record
+		binary, err = Unmarshal(data, &got)
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		got.Value = Decode(got.Value, binary.ValueBase64)
+		if got != want {
+			t.Fatalf("%s: got %+v, want %+v", data, got, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kv
+
+import (
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+)
+
+type BatchResult struct {
+	OpResult
+	Error string `json:"error,omitempty"`
+}
+
+// ValidateBatch rejects malformed batches before they reach the log.
+func ValidateBatch(ops []raft.TxnOp) error {
+	return validateOps(ops)
+}
+
+// applyBatch runs every op on its own at revision index: unlike a
+// transaction, a failing op leaves the others applied.
+func (sm *StateMachine) applyBatch(index int, entry raft.LogEntry) []BatchResult {
+	results := make([]BatchResult, len(entry.Ops))
+	for i, op := range entry.Ops {
+		err := sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+			var err error
+			results[i].OpResult, err = applyOp(tx, op, entry.Timestamp)
+			return err
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
@@ -0,0 +1,63 @@
+package kv
+
+import (
+	"errors"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+)
+
+func TestPreconditionsGuardWrites(t *testing.T) {
+	sm := newTestStateMachine(t)
+	index := 0
+	apply := func(entry raft.LogEntry) (WriteResult, error) {
+		t.Helper()
+		index++
+		result, err := sm.Apply(index, entry)
+		if err != nil {
+			return WriteResult{}, err
+		}
+		written, _ := result.(WriteResult)
+		return written, nil
+	}
+	mustApply := func(entry raft.LogEntry) WriteResult {
+		t.Helper()
+		written, err := apply(entry)
+		if err != nil {
+			t.Fatalf("entry %d: %v", index, err)
+		}
+		return written
+	}
+	failApply := func(entry raft.LogEntry) {
+		t.Helper()
+		if _, err := apply(entry); !errors.Is(err, storage.ErrPreconditionFailed) {
+			t.Fatalf("entry %d: got %v, want %v", index, err, storage.ErrPreconditionFailed)
+		}
+	}
+
+	first := mustApply(raft.LogEntry{Command: raft.OpCreate, Key: "a", Value: strPtr("1")})
+	second := mustApply(raft.LogEntry{Command: raft.OpSet, Key: "a", Value: strPtr("2"), IfMatch: []string{first.ETag}})
+	if second.ETag == first.ETag {
+		t.Fatalf("etag did not change: %s", second.ETag)
+	}
+	failApply(raft.LogEntry{Command: raft.OpSet, Key: "a", Value: strPtr("3"), IfMatch: []string{first.ETag}})
+	failApply(raft.LogEntry{Command: raft.OpSet, Key: "a", Value: strPtr("3"), IfNoneMatch: []string{"*"}})
+	failApply(raft.LogEntry{Command: raft.OpSet, Key: "a", Value: strPtr("3"), IfNoneMatch: []string{second.ETag}})
+	failApply(raft.LogEntry{Command: raft.OpDelete, Key: "a", IfMatch: []string{first.ETag}})
+	if value, err := sm.Storage().Get("a"); err != nil || value != "2" {
+		t.Fatalf("a after failed preconditions: got %q, %v", value, err)
+	}
+
+	// If-None-Match: * creates a missing key; If-Match: * needs one.
+	failApply(raft.LogEntry{Command: raft.OpSet, Key: "b", Value: strPtr("1"), IfMatch: []string{"*"}})
+	mustApply(raft.LogEntry{Command: raft.OpSet, Key: "b", Value: strPtr("1"), IfNoneMatch: []string{"*"}})
+	mustApply(raft.LogEntry{Command: raft.OpSet, Key: "b", Value: strPtr("2"), IfMatch: []string{"*"}})
+
+	mustApply(raft.LogEntry{Command: raft.OpDelete, Key: "a", IfMatch: []string{"stale", second.ETag}})
+	// A key created again starts over at version 1 but never reuses an ETag.
+	again := mustApply(raft.LogEntry{Command: raft.OpCreate, Key: "a", Value: strPtr("1")})
+	if again.Version != first.Version || again.ETag == first.ETag {
+		t.Fatalf("recreated key: got %+v, first %+v", again, first)
+	}
+	failApply(raft.LogEntry{Command: raft.OpDelete, Key: "a", IfMatch: []string{first.ETag}})
+}
@@ -0,0 +1,33 @@
+package kv
+
+import (
+	"fmt"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+)
+
+type ImportResult struct {
+	Revision int `json:"revision"`
+	Keys     int `json:"keys"`
+}
+
+// applyImport writes every key of a bulk import at revision index. Existing
+// keys are replaced, and a failing key fails the whole import.
+func (sm *StateMachine) applyImport(index int, entry raft.LogEntry) (ImportResult, error) {
+	err := sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		for _, op := range entry.Ops {
+			if op.Value == nil {
+				return fmt.Errorf("%w: no value for %q", ErrBadTxn, op.Key)
+			}
+			opts := writeOptions(entry.Timestamp, op.TTL, 0, op.ContentType)
+			if err := tx.Put(op.Key, *op.Value, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return ImportResult{Revision: index, Keys: len(entry.Ops)}, nil
+}
@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"slices"
+	"testing"
+	"time"
+)
+
+func exportRecords(t *testing.T, st *storage.Storage, revision int) []storage.Record {
+	t.Helper()
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	if err := st.Export(revision, func(record storage.Record) error { return enc.Encode(record) }); err != nil {
+		t.Fatal(err)
+	}
+	records := make([]storage.Record, 0)
+	dec := json.NewDecoder(&body)
+	for {
+		var record storage.Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return records
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newTestStateMachine(t)
+	now := time.Now().UnixMilli()
+	binary := "\xff\x00\xfe"
+	for index, entry := range []raft.LogEntry{
+		{Command: raft.OpCreateNamespace, Namespace: "team"},
+		{Command: raft.OpCreate, Key: "text", Value: strPtr("1")},
+		{Command: raft.OpCreate, Key: "bin", Value: &binary, ContentType: "image/png"},
+		{Command: raft.OpCreate, Key: "ttl", Value: strPtr("1"), TTL: time.Hour.Milliseconds()},
+		{Command: raft.OpCreate, Key: storage.NamespaceKey("team", "text"), Value: strPtr("2")},
+		{Command: raft.OpCreate, Key: "gone", Value: strPtr("1")},
+		{Command: raft.OpDelete, Key: "gone"},
+		{Command: raft.OpSet, Key: "text", Value: strPtr("3")},
+	} {
+		entry.Timestamp = now
+		if _, err := source.Apply(index+1, entry); err != nil {
+			t.Fatalf("entry %d: %v", index+1, err)
+		}
+	}
+
+	records := exportRecords(t, source.Storage(), 8)
+	keys := make([]string, len(records))
+	for i, record := range records {
+		keys[i] = record.Namespace + "/" + record.Key
+	}
+	// Records follow the stored keys, which put namespaces first.
+	if want := []string{"team/text", "/bin", "/text", "/ttl"}; !slices.Equal(keys, want) {
+		t.Fatalf("exported keys: got %v, want %v", keys, want)
+	}
+	if old := exportRecords(t, source.Storage(), 7); old[2].Key != "text" || old[2].Value != "1" {
+		t.Fatalf("export at revision 7: got %+v", old)
+	}
+
+	// Import the way the import handler does, into a fresh group.
+	target := newTestStateMachine(t)
+	if _, err := target.Apply(1, raft.LogEntry{Command: raft.OpCreateNamespace, Namespace: "team", Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+	ops := make([]raft.TxnOp, len(records))
+	for i, record := range records {
+		ops[i] = raft.TxnOp{
+			Command:     raft.OpSet,
+			Key:         storage.NamespaceKey(record.Namespace, record.Key),
+			Value:       &record.Value,
+			ContentType: record.ContentType,
+		}
+		if record.ExpiresAt > 0 {
+			ops[i].TTL = record.ExpiresAt - now
+		}
+	}
+	result, err := target.Apply(2, raft.LogEntry{Command: raft.OpImport, Ops: ops, Timestamp: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported := result.(ImportResult); imported.Keys != len(records) || imported.Revision != 2 {
+		t.Fatalf("import: got %+v", imported)
+	}
+
+	if got := exportRecords(t, target.Storage(), 2); !slices.Equal(got, records) {
+		t.Fatalf("round trip:\ngot  %+v\nwant %+v", got, records)
+	}
+}
@@ -0,0 +1,235 @@
+package kv
+
+import (
+	"log"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"slices"
+	"time"
+)
+
+type StateMachine struct {
+	storage *storage.Storage
+	// group scopes the IDs of sessions and leases.
+	group int
+
+	sessions       map[int]*session
+	sessionTimeout time.Duration
+}
+
+func NewStateMachine(storage *storage.Storage, group int, sessionTimeout time.Duration) (*StateMachine, error) {
+	sm := &StateMachine{
+		storage:        storage,
+		group:          group,
+		sessions:       make(map[int]*session),
+		sessionTimeout: sessionTimeout,
+	}
+	if err := sm.loadSessions(); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (sm *StateMachine) Storage() *storage.Storage {
+	return sm.storage
+}
+
+func (sm *StateMachine) AppliedIndex() int {
+	return sm.storage.AppliedIndex()
+}
+
+func (sm *StateMachine) Apply(index int, entry raft.LogEntry) (any, error) {
+	result, err := sm.applyEntry(index, entry)
+	if cerr := sm.storage.Commit(index); cerr != nil {
+		log.Printf("Failed to commit entry %d to storage: %v", index, cerr)
+		return nil, cerr
+	}
+	return result, err
+}
+
+func (sm *StateMachine) applyEntry(index int, entry raft.LogEntry) (any, error) {
+	switch entry.Command {
+	case raft.OpInit, raft.OpNoop:
+		return nil, nil
+	case raft.OpRegisterClient:
+		return sm.registerClient(index, entry)
+	case raft.OpExpireSessions:
+		sm.expireSessions(entry)
+		return nil, nil
+	case raft.OpCompact:
+		return nil, sm.storage.Compact(entry.Revision)
+	case raft.OpExpireKeys:
+		return nil, sm.expireKeys(index, entry)
+	case raft.OpCreateNamespace, raft.OpDropNamespace:
+		return nil, sm.applyNamespace(index, entry)
+	case raft.OpImport:
+		return sm.applyImport(index, entry)
+	case raft.OpGrantLease, raft.OpKeepAlive, raft.OpRevokeLease, raft.OpExpireLeases,
+		raft.OpAcquireLock, raft.OpReleaseLock:
+		return sm.applyLease(index, entry)
+	}
+	return sm.applySession(entry, func() (any, error) {
+		return sm.apply(index, entry)
+	})
+}
+
+// writeOptions turns a TTL in milliseconds into a deadline relative to the
+// leader timestamp of the entry.
+func writeOptions(timestamp, ttl int64, lease int, contentType string) storage.WriteOptions {
+	opts := storage.WriteOptions{
+		Lease:       lease,
+		ContentType: contentType,
+	}
+	if ttl > 0 {
+		opts.ExpiresAt = timestamp + ttl
+	}
+	return opts
+}
+
+// CounterResult is the value left by an increment or decrement.
+type CounterResult struct {
+	Value int64 `json:"value"`
+}
+
+// WriteResult describes the version left by a create, update or cas.
+type WriteResult struct {
+	Revision int    `json:"revision"`
+	Version  int    `json:"version"`
+	ETag     string `json:"etag"`
+}
+
+func written(tx *storage.Tx, key string) WriteResult {
+	version, _ := tx.Get(key)
+	return WriteResult{
+		Revision: version.Revision,
+		Version:  version.Version,
+		ETag:     version.ETag(),
+	}
+}
+
+func preconditions(entry raft.LogEntry) storage.Preconditions {
+	return storage.Preconditions{
+		IfMatch:     entry.IfMatch,
+		IfNoneMatch: entry.IfNoneMatch,
+	}
+}
+
+// apply runs a mutation at a revision equal to the index of its entry.
+func (sm *StateMachine) apply(index int, entry raft.LogEntry) (any, error) {
+	switch entry.Command {
+	case raft.OpTxn:
+		return sm.applyTxn(index, entry)
+	case raft.OpBatch:
+		return sm.applyBatch(index, entry), nil
+	}
+	var result any
+	err := sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		var err error
+		switch entry.Command {
+		case raft.OpCreate:
+			err = tx.Create(entry.Key, *entry.Value, writeOptions(entry.Timestamp, entry.TTL, entry.Lease, entry.ContentType))
+		case raft.OpSet:
+			if err = tx.Check(entry.Key, preconditions(entry)); err != nil {
+				return err
+			}
+			opts := writeOptions(entry.Timestamp, entry.TTL, entry.Lease, entry.ContentType)
+			// Only a missing key gets past If-None-Match: *, so create it.
+			if slices.Contains(entry.IfNoneMatch, "*") {
+				err = tx.Create(entry.Key, *entry.Value, opts)
+			} else {
+				err = tx.Set(entry.Key, *entry.Value, opts)
+			}
+		case raft.OpCAS:
+			err = tx.CAS(entry.Key, *entry.Value, *entry.CompareValue)
+		case raft.OpDelete:
+			if err = tx.Check(entry.Key, preconditions(entry)); err != nil {
+				return err
+			}
+			return tx.Delete(entry.Key)
+		case raft.OpIncrement, raft.OpDecrement:
+			delta := entry.Delta
+			if entry.Command == raft.OpDecrement {
+				delta = -delta
+			}
+			value, err := tx.Add(entry.Key, delta, storage.CounterOptions{
+				WriteOptions: writeOptions(entry.Timestamp, entry.TTL, entry.Lease, entry.ContentType),
+				Min:          entry.Min,
+				Max:          entry.Max,
+				Create:       entry.Create,
+			})
+			result = CounterResult{Value: value}
+			return err
+		default:
+			log.Printf("Got strange command number: %d", entry.Command)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result = written(tx, entry.Key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (sm *StateMachine) expireKeys(index int, entry raft.LogEntry) error {
+	return sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		for _, key := range entry.Keys {
+			if _, err := tx.Expire(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyLease handles lease and lock entries outside client sessions:
+// keep-alive, revoke and acquire are idempotent, and a retried grant only
+// leaves a lease to expire.
+func (sm *StateMachine) applyLease(index int, entry raft.LogEntry) (any, error) {
+	var result any
+	err := sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		var err error
+		switch entry.Command {
+		case raft.OpGrantLease:
+			result = tx.Grant(raft.ScopedID(sm.group, index), entry.TTL)
+		case raft.OpKeepAlive:
+			result, err = tx.KeepAlive(entry.Lease)
+		case raft.OpRevokeLease:
+			err = tx.Revoke(entry.Lease)
+		case raft.OpExpireLeases:
+			for _, id := range entry.Leases {
+				if _, err = tx.ExpireLease(id); err != nil {
+					break
+				}
+			}
+		case raft.OpAcquireLock:
+			result, err = tx.Acquire(entry.Key, entry.Lease)
+		case raft.OpReleaseLock:
+			err = tx.Release(entry.Key, entry.Lease)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyNamespace creates or drops a namespace; a drop deletes every key in
+// it within this one entry.
+func (sm *StateMachine) applyNamespace(index int, entry raft.LogEntry) error {
+	return sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		if entry.Command == raft.OpDropNamespace {
+			return tx.DropNamespace(entry.Namespace)
+		}
+		return tx.CreateNamespace(storage.Namespace{
+			Name:     entry.Namespace,
+			MaxKeys:  entry.MaxKeys,
+			MaxBytes: entry.MaxBytes,
+		})
+	})
+}
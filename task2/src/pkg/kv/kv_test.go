@@ -0,0 +1,34 @@
+package kv
+
+import (
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+	"time"
+)
+
+func newTestStateMachine(t *testing.T) *StateMachine {
+	t.Helper()
+	st, err := storage.NewStorage(storage.NewMemoryEngine())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewStateMachine(st, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+func TestApplyCommitsNoop(t *testing.T) {
+	sm := newTestStateMachine(t)
+	if _, err := sm.Apply(1, raft.LogEntry{Command: raft.OpInit}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Apply(2, raft.LogEntry{Command: raft.OpNoop}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.AppliedIndex(); got != 2 {
+		t.Fatalf("applied index: got %d, want 2", got)
+	}
+}
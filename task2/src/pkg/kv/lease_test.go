@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"errors"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+	"time"
+)
+
+func grantLease(t *testing.T, sm *StateMachine, index int, ttl, timestamp int64) int {
+	t.Helper()
+	result, err := sm.Apply(index, raft.LogEntry{Command: raft.OpGrantLease, TTL: ttl, Timestamp: timestamp})
+	if err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	return result.(storage.Lease).ID
+}
+
+func TestRevokeDeletesAttachedKeys(t *testing.T) {
+	sm := newTestStateMachine(t)
+	now := time.Now().UnixMilli()
+	lease := grantLease(t, sm, 1, time.Minute.Milliseconds(), now)
+	for index, entry := range []raft.LogEntry{
+		{Command: raft.OpCreate, Key: "a", Value: strPtr("1"), Lease: lease},
+		{Command: raft.OpCreate, Key: "b", Value: strPtr("1"), Lease: lease},
+		{Command: raft.OpCreate, Key: "c", Value: strPtr("1")},
+		// A set keeps the lease of the key; only a delete detaches it.
+		{Command: raft.OpSet, Key: "a", Value: strPtr("2")},
+		{Command: raft.OpDelete, Key: "b"},
+		{Command: raft.OpCreate, Key: "b", Value: strPtr("2")},
+	} {
+		entry.Timestamp = now
+		if _, err := sm.Apply(index+2, entry); err != nil {
+			t.Fatalf("entry %d: %v", index+2, err)
+		}
+	}
+	st := sm.Storage()
+	if _, keys, err := st.Lease(lease); err != nil || len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("lease keys: got %v, %v", keys, err)
+	}
+
+	if _, err := sm.Apply(8, raft.LogEntry{Command: raft.OpRevokeLease, Lease: lease, Timestamp: now}); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := st.Get("a"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("get a: got %v, want %v", err, storage.ErrKeyNotFound)
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, err := st.Get(key); err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+	}
+	if _, _, err := st.Lease(lease); !errors.Is(err, storage.ErrLeaseNotFound) {
+		t.Fatalf("revoked lease: got %v, want %v", err, storage.ErrLeaseNotFound)
+	}
+	_, err := sm.Apply(9, raft.LogEntry{Command: raft.OpCreate, Key: "d", Value: strPtr("1"), Lease: lease, Timestamp: now})
+	if !errors.Is(err, storage.ErrLeaseNotFound) {
+		t.Fatalf("create with revoked lease: got %v, want %v", err, storage.ErrLeaseNotFound)
+	}
+}
+
+func TestExpiredLeaseDeletesAttachedKeys(t *testing.T) {
+	sm := newTestStateMachine(t)
+	now := time.Now().UnixMilli()
+	expiring := grantLease(t, sm, 1, 500, now-1000)
+	renewed := grantLease(t, sm, 2, 500, now-1000)
+	apply := func(index int, entry raft.LogEntry) {
+		t.Helper()
+		if _, err := sm.Apply(index, entry); err != nil {
+			t.Fatalf("entry %d: %v", index, err)
+		}
+	}
+	apply(3, raft.LogEntry{Command: raft.OpCreate, Key: "a", Value: strPtr("1"), Lease: expiring, Timestamp: now - 1000})
+	apply(4, raft.LogEntry{Command: raft.OpCreate, Key: "b", Value: strPtr("1"), Lease: renewed, Timestamp: now - 1000})
+
+	st := sm.Storage()
+	expired := st.ExpiredLeases(now, 10)
+	if len(expired) != 2 || expired[0] != expiring || expired[1] != renewed {
+		t.Fatalf("expired leases: got %v", expired)
+	}
+	// A keep-alive that lands before the expiry entry saves the lease.
+	apply(5, raft.LogEntry{Command: raft.OpKeepAlive, Lease: renewed, Timestamp: now - 600})
+	apply(6, raft.LogEntry{Command: raft.OpExpireLeases, Leases: expired, Timestamp: now - 500})
+
+	if _, err := st.GetAt("a", 6); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("a after expiry: got %v, want %v", err, storage.ErrKeyNotFound)
+	}
+	if version, err := st.GetAt("b", 6); err != nil || version.Lease != renewed {
+		t.Fatalf("b after expiry: got %+v, %v", version, err)
+	}
+	if _, keys, err := st.Lease(renewed); err != nil || len(keys) != 1 {
+		t.Fatalf("renewed lease: got %v, %v", keys, err)
+	}
+}
@@ -0,0 +1,195 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSessionExpired = errors.New("client session expired or not registered")
+	ErrStaleSequence  = errors.New("sequence number already processed")
+	ErrBadSequence    = errors.New("sequence number must be positive")
+)
+
+// errorCodes name the errors a cached result may wrap, so that a restored
+// session returns one errors.Is still matches.
+var errorCodes = map[string]error{
+	"session_expired":     ErrSessionExpired,
+	"stale_sequence":      ErrStaleSequence,
+	"bad_sequence":        ErrBadSequence,
+	"bad_txn":             ErrBadTxn,
+	"key_not_found":       storage.ErrKeyNotFound,
+	"key_exists":          storage.ErrKeyExists,
+	"key_changed":         storage.ErrKeyChanged,
+	"key_reserved":        storage.ErrKeyReserved,
+	"compacted":           storage.ErrCompacted,
+	"future_revision":     storage.ErrFutureRevision,
+	"lease_not_found":     storage.ErrLeaseNotFound,
+	"not_lock_owner":      storage.ErrNotLockOwner,
+	"not_number":          storage.ErrNotNumber,
+	"out_of_bounds":       storage.ErrOutOfBounds,
+	"precondition_failed": storage.ErrPreconditionFailed,
+	"namespace_not_found": storage.ErrNamespaceNotFound,
+	"namespace_exists":    storage.ErrNamespaceExists,
+	"bad_namespace":       storage.ErrBadNamespace,
+}
+
+func errorCode(err error) string {
+	for code, known := range errorCodes {
+		if errors.Is(err, known) {
+			return code
+		}
+	}
+	return ""
+}
+
+// cachedError is an error restored from a session record.
+type cachedError struct {
+	message string
+	known   error
+}
+
+func (e *cachedError) Error() string {
+	return e.message
+}
+
+func (e *cachedError) Unwrap() error {
+	return e.known
+}
+
+type session struct {
+	lastSequence int
+	lastActive   int64
+	result       any
+	err          error
+}
+
+type sessionRecord struct {
+	LastSequence int             `json:"last_sequence"`
+	LastActive   int64           `json:"last_active"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	ErrorCode    string          `json:"error_code,omitempty"`
+}
+
+func sessionName(id int) string {
+	return fmt.Sprintf("session/%d", id)
+}
+
+func (sm *StateMachine) loadSessions() error {
+	for _, name := range sm.storage.MetaNames("session/") {
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "session/"))
+		if err != nil {
+			return fmt.Errorf("bad session name %q", name)
+		}
+		data, _, err := sm.storage.GetMeta(name)
+		if err != nil {
+			return err
+		}
+		var record sessionRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return fmt.Errorf("session %d: %w", id, err)
+		}
+
+		s := &session{
+			lastSequence: record.LastSequence,
+			lastActive:   record.LastActive,
+		}
+		if record.Result != nil {
+			s.result = record.Result
+		}
+		if record.Error != "" {
+			s.err = &cachedError{message: record.Error, known: errorCodes[record.ErrorCode]}
+		}
+		sm.sessions[id] = s
+	}
+	return nil
+}
+
+func (sm *StateMachine) saveSession(id int, s *session) {
+	record := sessionRecord{
+		LastSequence: s.lastSequence,
+		LastActive:   s.lastActive,
+	}
+	if s.result != nil {
+		data, err := json.Marshal(s.result)
+		if err != nil {
+			log.Printf("Failed to encode result of client %d: %v", id, err)
+		}
+		record.Result = data
+	}
+	if s.err != nil {
+		record.Error = s.err.Error()
+		record.ErrorCode = errorCode(s.err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode session of client %d: %v", id, err)
+		return
+	}
+	if err := sm.storage.SetMeta(sessionName(id), string(data)); err != nil {
+		log.Printf("Failed to save session of client %d: %v", id, err)
+	}
+}
+
+func (sm *StateMachine) registerClient(index int, entry raft.LogEntry) (any, error) {
+	id := raft.ScopedID(sm.group, index)
+	s := &session{
+		lastActive: entry.Timestamp,
+	}
+	sm.sessions[id] = s
+	sm.saveSession(id, s)
+	return id, nil
+}
+
+func (sm *StateMachine) expireSessions(entry raft.LogEntry) {
+	deadline := entry.Timestamp - sm.sessionTimeout.Milliseconds()
+	for id, s := range sm.sessions {
+		if s.lastActive < deadline {
+			log.Printf("Expiring session of client %d", id)
+			delete(sm.sessions, id)
+			if err := sm.storage.DeleteMeta(sessionName(id)); err != nil {
+				log.Printf("Failed to delete session of client %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// applySession runs apply at most once per client sequence number and
+// returns the cached response for retried requests.
+func (sm *StateMachine) applySession(entry raft.LogEntry, apply func() (any, error)) (any, error) {
+	if entry.ClientID == 0 {
+		return apply()
+	}
+
+	// Sequences start at 1, so a request without one can not pass for a
+	// retry of the last request of a fresh session.
+	if entry.Sequence <= 0 {
+		return nil, ErrBadSequence
+	}
+	s, ok := sm.sessions[entry.ClientID]
+	if !ok {
+		return nil, ErrSessionExpired
+	}
+	s.lastActive = entry.Timestamp
+	if s.lastSequence > 0 && entry.Sequence == s.lastSequence {
+		sm.saveSession(entry.ClientID, s)
+		return s.result, s.err
+	}
+	if entry.Sequence < s.lastSequence {
+		sm.saveSession(entry.ClientID, s)
+		return nil, ErrStaleSequence
+	}
+
+	s.lastSequence = entry.Sequence
+	s.result, s.err = apply()
+	sm.saveSession(entry.ClientID, s)
+	return s.result, s.err
+}
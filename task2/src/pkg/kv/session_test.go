@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+	"time"
+)
+
+func TestSessionRejectsMissingSequence(t *testing.T) {
+	sm := newTestStateMachine(t)
+	result, err := sm.Apply(1, raft.LogEntry{Command: raft.OpRegisterClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := result.(int)
+
+	value := "v"
+	create := raft.LogEntry{Command: raft.OpCreate, ClientID: client, Key: "k", Value: &value}
+	if _, err := sm.Apply(2, create); !errors.Is(err, ErrBadSequence) {
+		t.Fatalf("create without sequence: got %v, want %v", err, ErrBadSequence)
+	}
+
+	create.Sequence = 1
+	if _, err := sm.Apply(3, create); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, err := sm.Storage().Get("k"); err != nil || got != value {
+		t.Fatalf("get: got %q, %v", got, err)
+	}
+
+	// A retry gets the cached result instead of ErrKeyExists.
+	if _, err := sm.Apply(4, create); err != nil {
+		t.Fatalf("retried create: %v", err)
+	}
+}
+
+func TestSessionRestoresCachedErrors(t *testing.T) {
+	sm := newTestStateMachine(t)
+	result, err := sm.Apply(1, raft.LogEntry{Command: raft.OpRegisterClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := result.(int)
+
+	value := "v"
+	if _, err := sm.Apply(2, raft.LogEntry{Command: raft.OpCreate, Key: "k", Value: &value}); err != nil {
+		t.Fatal(err)
+	}
+	create := raft.LogEntry{Command: raft.OpCreate, ClientID: client, Sequence: 1, Key: "k", Value: &value}
+	_, failed := sm.Apply(3, create)
+	if !errors.Is(failed, storage.ErrKeyExists) {
+		t.Fatalf("create: got %v, want %v", failed, storage.ErrKeyExists)
+	}
+
+	restarted, err := NewStateMachine(sm.Storage(), 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, retried := restarted.Apply(4, create)
+	if !errors.Is(retried, storage.ErrKeyExists) || retried.Error() != failed.Error() {
+		t.Fatalf("retried create after restart: got %v, want %v", retried, failed)
+	}
+
+	wrapped := fmt.Errorf("op 0 on %q: %w", "k", storage.ErrNotLockOwner)
+	if code := errorCode(wrapped); errorCodes[code] != storage.ErrNotLockOwner {
+		t.Fatalf("code of %v: got %q", wrapped, code)
+	}
+}
@@ -0,0 +1,59 @@
+package kv
+
+import (
+	"errors"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+	"time"
+)
+
+func TestTTLHidesAndExpiresKeys(t *testing.T) {
+	sm := newTestStateMachine(t)
+	now := time.Now().UnixMilli()
+	apply := func(index int, entry raft.LogEntry) {
+		t.Helper()
+		if _, err := sm.Apply(index, entry); err != nil {
+			t.Fatalf("entry %d: %v", index, err)
+		}
+	}
+	// Written a second ago with half a second to live.
+	apply(1, raft.LogEntry{Command: raft.OpCreate, Key: "short", Value: strPtr("1"), TTL: 500, Timestamp: now - 1000})
+	apply(2, raft.LogEntry{Command: raft.OpCreate, Key: "renewed", Value: strPtr("1"), TTL: 500, Timestamp: now - 1000})
+	apply(3, raft.LogEntry{Command: raft.OpCreate, Key: "long", Value: strPtr("1"), TTL: time.Hour.Milliseconds(), Timestamp: now})
+
+	st := sm.Storage()
+	if _, err := st.Get("short"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("get expired key: got %v, want %v", err, storage.ErrKeyNotFound)
+	}
+	if result, err := st.Range(storage.RangeOptions{}); err != nil || result.Count != 1 || result.KVs[0].Key != "long" {
+		t.Fatalf("range: got %+v, %v", result, err)
+	}
+	expired := st.ExpiredKeys(now, 10)
+	if len(expired) != 2 || expired[0] != "renewed" || expired[1] != "short" {
+		t.Fatalf("expired keys: got %v", expired)
+	}
+
+	// An update without a TTL keeps the deadline of the key.
+	apply(4, raft.LogEntry{Command: raft.OpSet, Key: "long", Value: strPtr("2"), Timestamp: now})
+	if version, err := st.GetVersion("long"); err != nil || version.ExpiresAt != now+time.Hour.Milliseconds() {
+		t.Fatalf("long after update: got %+v, %v", version, err)
+	}
+
+	// A key written again after the leader saw it expire survives the
+	// expiry entry.
+	apply(5, raft.LogEntry{Command: raft.OpCreate, Key: "renewed", Value: strPtr("2"), Timestamp: now})
+	apply(6, raft.LogEntry{Command: raft.OpExpireKeys, Keys: expired, Timestamp: now})
+	if value, err := st.Get("renewed"); err != nil || value != "2" {
+		t.Fatalf("get renewed key: got %q, %v", value, err)
+	}
+	if version, err := st.GetAt("short", 6); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("short after expiry: got %+v, %v", version, err)
+	}
+	if version, err := st.GetAt("short", 5); err != nil || version.Value != "1" {
+		t.Fatalf("short before expiry: got %+v, %v", version, err)
+	}
+	if keys := st.ExpiredKeys(now+1000, 10); len(keys) != 0 {
+		t.Fatalf("expired keys after expiry: got %v", keys)
+	}
+}
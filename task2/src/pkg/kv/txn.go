@@ -0,0 +1,190 @@
+package kv
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"raft/pkg/jsonvalue"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"strings"
+)
+
+var ErrBadTxn = errors.New("bad transaction")
+
+type TxnResult struct {
+	Succeeded bool       `json:"succeeded"`
+	Results   []OpResult `json:"results"`
+}
+
+type OpResult struct {
+	Key         string `json:"key"`
+	Found       bool   `json:"found,omitempty"`
+	Value       string `json:"value,omitempty"`
+	ValueBase64 []byte `json:"value_base64,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Revision    int    `json:"revision,omitempty"`
+	Version     int    `json:"version,omitempty"`
+}
+
+// ValidateTxn rejects malformed transactions before they reach the log.
+func ValidateTxn(txn *raft.Txn) error {
+	for _, c := range txn.Compare {
+		switch c.Target {
+		case "exists":
+			if c.Op != "==" && c.Op != "!=" {
+				return fmt.Errorf("%w: exists compare supports == and != only", ErrBadTxn)
+			}
+		case "value", "version":
+			if _, err := compareResult(c.Op, 0); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown compare target %q", ErrBadTxn, c.Target)
+		}
+	}
+	return validateOps(append(append([]raft.TxnOp{}, txn.Success...), txn.Failure...))
+}
+
+func validateOps(ops []raft.TxnOp) error {
+	for _, op := range ops {
+		switch op.Command {
+		case raft.OpGet, raft.OpDelete:
+		case raft.OpCreate, raft.OpSet:
+			if op.Value == nil {
+				return fmt.Errorf("%w: op on %q needs a value", ErrBadTxn, op.Key)
+			}
+			if op.TTL < 0 {
+				return fmt.Errorf("%w: negative ttl on %q", ErrBadTxn, op.Key)
+			}
+		case raft.OpCAS:
+			if op.Value == nil || op.CompareValue == nil {
+				return fmt.Errorf("%w: cas on %q needs value and compare_value", ErrBadTxn, op.Key)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported op %d", ErrBadTxn, op.Command)
+		}
+	}
+	return nil
+}
+
+func compareResult(op string, order int) (bool, error) {
+	switch op {
+	case "==":
+		return order == 0, nil
+	case "!=":
+		return order != 0, nil
+	case "<":
+		return order < 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return false, fmt.Errorf("%w: unknown compare op %q", ErrBadTxn, op)
+}
+
+func compare(tx *storage.Tx, c raft.Compare) (bool, error) {
+	version, err := tx.Get(c.Key)
+	found := err == nil
+	if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+		return false, err
+	}
+
+	switch c.Target {
+	case "exists":
+		return compareResult(c.Op, cmp.Compare(boolInt(found), boolInt(c.Exists)))
+	case "value":
+		if !found {
+			return false, nil
+		}
+		return compareResult(c.Op, strings.Compare(version.Value, c.Value))
+	case "version":
+		// A missing key has version 0.
+		return compareResult(c.Op, cmp.Compare(version.Version, c.Version))
+	}
+	return false, fmt.Errorf("%w: unknown compare target %q", ErrBadTxn, c.Target)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func applyOp(tx *storage.Tx, op raft.TxnOp, timestamp int64) (OpResult, error) {
+	_, key := storage.SplitKey(op.Key)
+	result := OpResult{
+		Key: key,
+	}
+	var err error
+	switch op.Command {
+	case raft.OpGet:
+		version, err := tx.Get(op.Key)
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Found = true
+		result.Value, result.ValueBase64 = jsonvalue.Encode(version.Value)
+		result.ContentType = version.ContentType
+		result.Revision = version.Revision
+		result.Version = version.Version
+		return result, nil
+	case raft.OpCreate:
+		err = tx.Create(op.Key, *op.Value, writeOptions(timestamp, op.TTL, op.Lease, op.ContentType))
+	case raft.OpSet:
+		err = tx.Set(op.Key, *op.Value, writeOptions(timestamp, op.TTL, op.Lease, op.ContentType))
+	case raft.OpCAS:
+		err = tx.CAS(op.Key, *op.Value, *op.CompareValue)
+	case raft.OpDelete:
+		err = tx.Delete(op.Key)
+	default:
+		err = fmt.Errorf("%w: unsupported op %d", ErrBadTxn, op.Command)
+	}
+	return result, err
+}
+
+// applyTxn evaluates the comparisons and runs one op branch at revision
+// index. A failing op aborts the whole transaction.
+func (sm *StateMachine) applyTxn(index int, entry raft.LogEntry) (any, error) {
+	txn := entry.Txn
+	if txn == nil {
+		return nil, ErrBadTxn
+	}
+	var result TxnResult
+	err := sm.storage.Update(index, entry.Timestamp, func(tx *storage.Tx) error {
+		result = TxnResult{
+			Succeeded: true,
+			Results:   make([]OpResult, 0),
+		}
+		for _, c := range txn.Compare {
+			ok, err := compare(tx, c)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				result.Succeeded = false
+				break
+			}
+		}
+
+		ops := txn.Success
+		if !result.Succeeded {
+			ops = txn.Failure
+		}
+		for i, op := range ops {
+			opResult, err := applyOp(tx, op, entry.Timestamp)
+			if err != nil {
+				return fmt.Errorf("op %d on %q: %w", i, op.Key, err)
+			}
+			result.Results = append(result.Results, opResult)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package kv
+
+import (
+	"errors"
+	"raft/pkg/raft"
+	"raft/pkg/storage"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func applyTxn(t *testing.T, sm *StateMachine, index int, txn raft.Txn) (TxnResult, error) {
+	t.Helper()
+	result, err := sm.Apply(index, raft.LogEntry{Command: raft.OpTxn, Txn: &txn})
+	if err != nil {
+		return TxnResult{}, err
+	}
+	return result.(TxnResult), nil
+}
+
+func TestTxnCompares(t *testing.T) {
+	sm := newTestStateMachine(t)
+	sm.Apply(1, raft.LogEntry{Command: raft.OpCreate, Key: "a", Value: strPtr("4")})
+	sm.Apply(2, raft.LogEntry{Command: raft.OpSet, Key: "a", Value: strPtr("5")})
+
+	tests := []struct {
+		compare raft.Compare
+		want    bool
+	}{
+		{raft.Compare{Key: "a", Target: "value", Op: "==", Value: "5"}, true},
+		{raft.Compare{Key: "a", Target: "value", Op: "!=", Value: "5"}, false},
+		{raft.Compare{Key: "a", Target: "value", Op: "<", Value: "6"}, true},
+		{raft.Compare{Key: "a", Target: "value", Op: ">", Value: "6"}, false},
+		// A missing key has no value to compare, not an empty one.
+		{raft.Compare{Key: "x", Target: "value", Op: "==", Value: ""}, false},
+		{raft.Compare{Key: "x", Target: "value", Op: "!=", Value: "5"}, false},
+		{raft.Compare{Key: "a", Target: "exists", Op: "==", Exists: true}, true},
+		{raft.Compare{Key: "x", Target: "exists", Op: "==", Exists: false}, true},
+		{raft.Compare{Key: "x", Target: "exists", Op: "!=", Exists: true}, true},
+		{raft.Compare{Key: "a", Target: "version", Op: "==", Version: 2}, true},
+		{raft.Compare{Key: "a", Target: "version", Op: ">", Version: 2}, false},
+		{raft.Compare{Key: "x", Target: "version", Op: "==", Version: 0}, true},
+	}
+	index := 3
+	for _, test := range tests {
+		result, err := applyTxn(t, sm, index, raft.Txn{Compare: []raft.Compare{test.compare}})
+		index++
+		if err != nil {
+			t.Fatalf("%+v: %v", test.compare, err)
+		}
+		if result.Succeeded != test.want {
+			t.Errorf("%+v: got %v, want %v", test.compare, result.Succeeded, test.want)
+		}
+	}
+
+	// Every comparison must hold for the success branch.
+	result, err := applyTxn(t, sm, index, raft.Txn{
+		Compare: []raft.Compare{
+			{Key: "a", Target: "value", Op: "==", Value: "5"},
+			{Key: "a", Target: "version", Op: "==", Version: 1},
+		},
+		Success: []raft.TxnOp{{Command: raft.OpSet, Key: "a", Value: strPtr("yes")}},
+		Failure: []raft.TxnOp{{Command: raft.OpSet, Key: "a", Value: strPtr("no")}, {Command: raft.OpGet, Key: "a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Succeeded || len(result.Results) != 2 || result.Results[1].Value != "no" {
+		t.Fatalf("failure branch: got %+v", result)
+	}
+}
+
+func TestTxnFailingOpAbortsBranch(t *testing.T) {
+	sm := newTestStateMachine(t)
+	sm.Apply(1, raft.LogEntry{Command: raft.OpCreate, Key: "a", Value: strPtr("1")})
+
+	_, err := applyTxn(t, sm, 2, raft.Txn{
+		Success: []raft.TxnOp{
+			{Command: raft.OpCreate, Key: "b", Value: strPtr("2")},
+			{Command: raft.OpCreate, Key: "a", Value: strPtr("2")},
+		},
+	})
+	if !errors.Is(err, storage.ErrKeyExists) {
+		t.Fatalf("txn: got %v, want %v", err, storage.ErrKeyExists)
+	}
+	if _, err := sm.Storage().Get("b"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Fatalf("get b: got %v, want %v", err, storage.ErrKeyNotFound)
+	}
+	if err := ValidateTxn(&raft.Txn{Compare: []raft.Compare{{Key: "a", Target: "exists", Op: "<"}}}); !errors.Is(err, ErrBadTxn) {
+		t.Fatalf("validate exists <: got %v, want %v", err, ErrBadTxn)
+	}
+}
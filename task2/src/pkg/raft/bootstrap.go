@@ -0,0 +1,127 @@
+package raft
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+)
+
+var (
+	ErrAlreadyBootstrapped = errors.New("node already has raft state")
+	ErrClusterMismatch     = errors.New("request is from another cluster")
+)
+
+func NewClusterID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (r *Raft) members() []string {
+	members := append([]string{r.config.ID}, r.config.Peers...)
+	slices.Sort(members)
+	return members
+}
+
+func (r *Raft) restore() error {
+	entries, err := r.store.LoadLog()
+	if err != nil {
+		return err
+	}
+	r.logs = append(r.logs, entries...)
+
+	// Entries up to the applied index are already in the state machine.
+	applied := r.fsm.AppliedIndex()
+	if applied >= len(r.logs) {
+		return fmt.Errorf("state machine applied index %d is ahead of log length %d", applied, len(r.logs))
+	}
+	r.commitIndex = applied
+	r.lastApplied = applied
+
+	state, err := r.store.Load()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+	if state.ClusterID != "" && !slices.Equal(state.Members, r.members()) {
+		return fmt.Errorf("stored membership %v does not match config %v", state.Members, r.members())
+	}
+	r.clusterID = state.ClusterID
+	r.metaInfo.Term = state.Term
+	r.metaInfo.VotedFor = state.VotedFor
+	return nil
+}
+
+// persist saves the term, vote and cluster. Failures are logged; callers
+// that would promise something on the saved state must check the error.
+func (r *Raft) persist() error {
+	err := r.store.Save(HardState{
+		ClusterID: r.clusterID,
+		Members:   r.members(),
+		Term:      r.metaInfo.Term,
+		VotedFor:  r.metaInfo.VotedFor,
+	})
+	if err != nil {
+		log.Printf("Failed to persist raft state: %v", err)
+	}
+	return err
+}
+
+// appendLog replaces the log from index onward with entries. If they cannot
+// be stored the log ends before index, so none of them is acked or applied.
+func (r *Raft) appendLog(index int, entries ...LogEntry) error {
+	r.logs = r.logs[:index]
+	if err := r.store.StoreLog(index, entries); err != nil {
+		log.Printf("Failed to persist raft log: %v", err)
+		return err
+	}
+	r.logs = append(r.logs, entries...)
+	return nil
+}
+
+// Bootstrap initializes a fresh node as the first member of a new cluster
+// and starts an election. Uninitialized peers join once the leader reaches them.
+func (r *Raft) Bootstrap(clusterID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.clusterID != "" || r.metaInfo.Term > 0 || len(r.logs) > 1 {
+		return ErrAlreadyBootstrapped
+	}
+	log.Printf("Bootstrapping cluster %s with members %v", clusterID, r.members())
+	r.clusterID = clusterID
+	if err := r.persist(); err != nil {
+		r.clusterID = ""
+		return err
+	}
+	go r.BecomeCandidate()
+	return nil
+}
+
+func (r *Raft) ClusterID() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.clusterID
+}
+
+// checkCluster rejects requests from other clusters and lets an
+// uninitialized node join the cluster of the leader that contacts it.
+func (r *Raft) checkCluster(clusterID string, fromLeader bool) error {
+	if clusterID == "" || r.clusterID == clusterID {
+		return nil
+	}
+	if r.clusterID != "" {
+		return ErrClusterMismatch
+	}
+	if fromLeader {
+		log.Printf("Joining cluster %s", clusterID)
+		r.clusterID = clusterID
+		r.persist()
+	}
+	return nil
+}
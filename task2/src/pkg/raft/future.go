@@ -0,0 +1,48 @@
+package raft
+
+import "context"
+
+type Future struct {
+	index int
+	term  int
+	done  chan struct{}
+
+	result any
+	err    error
+}
+
+func newFuture(index, term int) *Future {
+	return &Future{
+		index: index,
+		term:  term,
+		done:  make(chan struct{}),
+	}
+}
+
+func (f *Future) Index() int {
+	return f.index
+}
+
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result must only be called after Done is closed.
+func (f *Future) Result() (any, error) {
+	return f.result, f.err
+}
+
+func (f *Future) Wait(ctx context.Context) (any, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *Future) resolve(result any, err error) {
+	f.result = result
+	f.err = err
+	close(f.done)
+}
@@ -1,65 +1,142 @@
 package raft
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
 )
 
 func (r *Raft) Heartbeat() {
+	ticker := time.NewTicker(r.config.LeaderHeartbeatDuration)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(r.config.LeaderHeartbeatDuration)
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
 
 		r.Lock()
-		r.metaInfo.Lock()
-
 		if r.metaInfo.Status != Leader {
-			r.metaInfo.Unlock()
 			r.Unlock()
 			continue
 		}
-		log.Printf("Sending heartbeat to %d followers", len(r.config.OtherPorts))
+		term := r.metaInfo.Term
+		log.Printf("Sending heartbeat to %d followers", len(r.config.Peers))
+		r.Unlock()
 
 		wg := sync.WaitGroup{}
-		toFollower := 0
-		toFollowerMtx := sync.Mutex{}
-
-		for _, port := range r.config.OtherPorts {
+		for _, peer := range r.config.Peers {
 			wg.Add(1)
-			go func(port int) {
+			go func(peer string) {
 				defer wg.Done()
-				last := r.syncedIdx[port]
-				req := AppendEntriesRequest{
-					LeaderID:          r.config.ServerPort,
-					LeaderCommitIndex: r.commitIndex,
-					ParentLogIndex:    last,
-					ParentLogTerm:     r.logs[last].Term,
-					Entries:           r.logs[last+1:],
-				}
-				res, err := r.SendAppendRequest(GetAddress(port), req)
-				if err != nil {
-					log.Printf("Error sending heartbeat to %d: %v", port, err)
-					return
-				}
-				if res.Success {
-					return
-				}
-				if res.Term > r.metaInfo.Term {
-					toFollowerMtx.Lock()
-					toFollower++
-					toFollowerMtx.Unlock()
-				} else {
-					r.syncedIdx[port]--
-				}
-			}(port)
+				r.sendAppend(peer, term)
+			}(peer)
 		}
 		wg.Wait()
+	}
+}
 
-		if toFollower > 0 {
-			r.metaInfo.Status = Follower
-		}
+func (r *Raft) notifyReplicate() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
 
-		r.metaInfo.Unlock()
+func (r *Raft) sendAppend(peer string, term int) {
+	r.Lock()
+	if r.metaInfo.Status != Leader || r.metaInfo.Term != term {
 		r.Unlock()
+		return
+	}
+	last := r.syncedIdx[peer]
+	req := AppendEntriesRequest{
+		Base: Base{
+			Term: term,
+		},
+		ClusterID:         r.clusterID,
+		LeaderID:          r.config.ID,
+		LeaderCommitIndex: r.commitIndex,
+		ParentLogIndex:    last,
+		ParentLogTerm:     r.logs[last].Term,
+		Entries:           append(Log{}, r.logs[last+1:]...),
+	}
+	if r.config.Witnesses[peer] {
+		for i, entry := range req.Entries {
+			req.Entries[i] = entry.Metadata()
+		}
+	}
+	r.Unlock()
+
+	res, err := r.transport.AppendEntries(peer, req)
+	if err != nil {
+		log.Printf("Error sending heartbeat to %s: %v", peer, err)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if res.Term > r.metaInfo.Term {
+		if r.metaInfo.Status == Leader {
+			r.metaInfo.StepDownReason = fmt.Sprintf("peer %s has higher term %d", peer, res.Term)
+		}
+		r.becomeFollower(res.Term, "")
+		return
+	}
+	if r.metaInfo.Status != Leader || r.metaInfo.Term != term {
+		return
+	}
+	r.lastAck[peer] = time.Now()
+
+	if res.Success {
+		matched := last + len(req.Entries)
+		if matched > r.matchIdx[peer] {
+			r.matchIdx[peer] = matched
+		}
+		r.syncedIdx[peer] = max(r.syncedIdx[peer], matched)
+		r.advanceCommit()
+		return
+	}
+	if r.syncedIdx[peer] == last && last > 0 {
+		r.syncedIdx[peer]--
+		r.notifyReplicate()
+	}
+}
+
+func (r *Raft) advanceCommit() {
+	for idx := len(r.logs) - 1; idx > r.commitIndex; idx-- {
+		if r.logs[idx].Term != r.metaInfo.Term {
+			break
+		}
+		acked := 1
+		for _, match := range r.matchIdx {
+			if match >= idx {
+				acked++
+			}
+		}
+		if acked*2 > len(r.config.Peers)+1 {
+			r.commitIndex = idx
+			r.applyCommitted()
+			r.notifyReplicate()
+			return
+		}
+	}
+}
+
+func (r *Raft) checkQuorum() {
+	acked := 1
+	for _, peer := range r.config.Peers {
+		if time.Since(r.lastAck[peer]) < r.config.FollowerHeartbeatWaiting {
+			acked++
+		}
+	}
+	if acked*2 > len(r.config.Peers)+1 {
+		return
 	}
+	r.stepDown(fmt.Sprintf("heard from %d of %d nodes within %s", acked, len(r.config.Peers)+1, r.config.FollowerHeartbeatWaiting))
 }
@@ -0,0 +1,60 @@
+package raft
+
+import (
+	"raft/pkg/jsonvalue"
+)
+
+func splitBinary(value **string, binary *[]byte) {
+	if *value == nil {
+		return
+	}
+	if _, raw := jsonvalue.Encode(**value); raw != nil {
+		*binary = raw
+		*value = nil
+	}
+}
+
+func joinBinary(value **string, binary []byte) {
+	if binary != nil {
+		s := string(binary)
+		*value = &s
+	}
+}
+
+func (e LogEntry) MarshalJSON() ([]byte, error) {
+	type plain LogEntry
+	var binary jsonvalue.Binary
+	splitBinary(&e.Value, &binary.ValueBase64)
+	splitBinary(&e.CompareValue, &binary.CompareValueBase64)
+	return jsonvalue.Marshal(plain(e), binary)
+}
+
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	type plain LogEntry
+	binary, err := jsonvalue.Unmarshal(data, (*plain)(e))
+	if err != nil {
+		return err
+	}
+	joinBinary(&e.Value, binary.ValueBase64)
+	joinBinary(&e.CompareValue, binary.CompareValueBase64)
+	return nil
+}
+
+func (op TxnOp) MarshalJSON() ([]byte, error) {
+	type plain TxnOp
+	var binary jsonvalue.Binary
+	splitBinary(&op.Value, &binary.ValueBase64)
+	splitBinary(&op.CompareValue, &binary.CompareValueBase64)
+	return jsonvalue.Marshal(plain(op), binary)
+}
+
+func (op *TxnOp) UnmarshalJSON(data []byte) error {
+	type plain TxnOp
+	binary, err := jsonvalue.Unmarshal(data, (*plain)(op))
+	if err != nil {
+		return err
+	}
+	joinBinary(&op.Value, binary.ValueBase64)
+	joinBinary(&op.CompareValue, binary.CompareValueBase64)
+	return nil
+}
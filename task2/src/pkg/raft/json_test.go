@@ -0,0 +1,55 @@
+package raft
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogEntryKeepsBinaryValues(t *testing.T) {
+	binary, text := "\xff\x00bin", "text"
+	for _, want := range []LogEntry{
+		{Command: OpCreate, Key: "k", Value: &binary, ContentType: "application/octet-stream"},
+		{Command: OpCAS, Key: "k", Value: &text, CompareValue: &binary},
+		{Command: OpSet, Key: "k", Value: &text},
+		{Command: OpDelete, Key: "k"},
+	} {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(data) || strings.Contains(string(data), "\\ufffd") {
+			t.Fatalf("%s: value was mangled", data)
+		}
+		var got LogEntry
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if !sameValue(got.Value, want.Value) || !sameValue(got.CompareValue, want.CompareValue) || got.ContentType != want.ContentType {
+			t.Fatalf("%s: got %+v, want %+v", data, got, want)
+		}
+	}
+}
+
+func TestTxnOpKeepsBinaryValues(t *testing.T) {
+	binary := "\x80\x81"
+	want := TxnOp{Key: "k", Value: &binary, CompareValue: &binary}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got TxnOp
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	if !sameValue(got.Value, want.Value) || !sameValue(got.CompareValue, want.CompareValue) {
+		t.Fatalf("%s: got %+v, want %+v", data, got, want)
+	}
+}
+
+func sameValue(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
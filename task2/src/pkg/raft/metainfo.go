@@ -1,7 +1,5 @@
 package raft
 
-import "sync"
-
 type Status int
 
 const (
@@ -10,10 +8,33 @@ const (
 	Leader
 )
 
+func (s Status) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type MetaInfo struct {
-	sync.Mutex
+	Term           int    `json:"term"`
+	Status         Status `json:"status"`
+	LeaderID       string `json:"leader_id"`
+	VotedFor       string `json:"voted_for"`
+	StepDownReason string `json:"step_down_reason,omitempty"`
+}
+
+type RoleChange struct {
 	Term     int
 	Status   Status
-	LeaderID int
-	VotedFor int
+	LeaderID string
+	Reason   string
 }
@@ -1,48 +1,65 @@
 package raft
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"log"
-	"net/http"
 	"raft/pkg/config"
-	"raft/pkg/storage"
 	"sync"
 	"time"
+)
 
-	"github.com/labstack/echo/v4"
+var (
+	ErrNotLeader      = errors.New("not leader")
+	ErrStopped        = errors.New("raft stopped")
+	ErrLeadershipLost = errors.New("leadership lost before entry was applied")
 )
 
+type StateMachine interface {
+	Apply(index int, entry LogEntry) (any, error)
+	// AppliedIndex is the last index whose effects survived a restart.
+	AppliedIndex() int
+}
+
 type Raft struct {
 	sync.Mutex
 
-	metaInfo MetaInfo
-	config   *config.Config
-	client   *http.Client
-
-	storage storage.Storage
+	metaInfo  MetaInfo
+	config    *config.Config
+	transport Transport
+	fsm       StateMachine
+	store     StableStore
+	clusterID string
 
 	logs        Log
-	syncedIdx   map[int]int
+	syncedIdx   map[string]int
+	matchIdx    map[string]int
+	lastAck     map[string]time.Time
 	commitIndex int
+	lastApplied int
+	futures     map[int]*Future
+	noopIndex   int
+	ready       chan struct{}
+
+	observers []chan RoleChange
+	trigger   chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
 
 	lastHeartbeatTime time.Time
 	lastTry           time.Time
+	lastTransfer      time.Time
 	electionTimeout   time.Duration
+	priorityMissed    bool
 }
 
-func NewRaft(config *config.Config) *Raft {
-	initStatus := Follower
-	if config.LeaderOnStart {
-		initStatus = Leader
-	}
+func NewRaft(config *config.Config, transport Transport, fsm StateMachine, store StableStore) (*Raft, error) {
 	raft := &Raft{
 		metaInfo: MetaInfo{
 			Term:     0,
-			Status:   initStatus,
-			LeaderID: -1,
-			VotedFor: -1,
+			Status:   Follower,
+			LeaderID: "",
+			VotedFor: "",
 		},
 		logs: []LogEntry{
 			{
@@ -52,60 +69,153 @@ func NewRaft(config *config.Config) *Raft {
 				Command: OpInit,
 			},
 		},
-		syncedIdx:   make(map[int]int),
+		syncedIdx:   make(map[string]int),
+		matchIdx:    make(map[string]int),
+		lastAck:     make(map[string]time.Time),
 		commitIndex: 0,
+		lastApplied: 0,
+		futures:     make(map[int]*Future),
+		ready:       make(chan struct{}),
 		config:      config,
-		client:      &http.Client{Timeout: config.ResponseTimeout},
-		storage:     *storage.NewStorage(),
+		transport:   transport,
+		fsm:         fsm,
+		store:       store,
+
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
 
 		lastHeartbeatTime: time.Now(),
 		lastTry:           time.Now(),
 		electionTimeout:   0,
 	}
-	for _, port := range config.OtherPorts {
-		raft.syncedIdx[port] = 0
+	for _, peer := range config.Peers {
+		raft.syncedIdx[peer] = 0
+		raft.matchIdx[peer] = 0
+	}
+	if err := raft.restore(); err != nil {
+		return nil, err
 	}
-	log.Printf("Initialized raft on port %d", config.ServerPort)
-	return raft
+	log.Printf("Initialized raft node %s in term %d with %d log entries, applied up to %d", config.ID, raft.metaInfo.Term, len(raft.logs)-1, raft.lastApplied)
+	return raft, nil
 }
 
-func (r *Raft) Start() error {
-	e := echo.New()
+func (r *Raft) Start() {
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		r.WaitHeartbeat()
+	}()
+	go func() {
+		defer r.wg.Done()
+		r.Heartbeat()
+	}()
+}
 
-	client := e.Group("/api")
-	client.POST("/create", r.CreateRequestHandler)
-	client.GET("/read", r.ReadRequestHandler)
-	client.POST("/update", r.UpdateRequestHandler)
-	client.POST("/delete", r.DeleteRequestHandler)
-	client.POST("/cas", r.CASRequestHandler)
-	client.GET("/get_replicas", r.GetReplicasRequestHandler)
+func (r *Raft) Stop() {
+	r.Lock()
+	select {
+	case <-r.stop:
+		r.Unlock()
+		return
+	default:
+	}
+	close(r.stop)
+	r.failFutures(ErrStopped)
+	r.Unlock()
 
-	raft := e.Group("/raft")
-	raft.POST("/request_vote", r.RequestVoteRequestHandler)
-	raft.POST("/add_log", r.AddLogRequestHandler)
+	r.wg.Wait()
 
-	go r.WaitHeartbeat()
-	go r.Heartbeat()
+	r.Lock()
+	for _, ch := range r.observers {
+		close(ch)
+	}
+	r.observers = nil
+	r.Unlock()
+}
 
-	s := &http.Server{
-		Addr:           fmt.Sprintf(":%d", r.config.ServerPort),
-		ReadTimeout:    30 * time.Second,
-		WriteTimeout:   30 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+func (r *Raft) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
 	}
+}
 
-	return e.StartServer(s)
+// Observe returns a channel receiving every role change of this node.
+// Changes are dropped if the receiver falls behind the channel buffer.
+func (r *Raft) Observe() <-chan RoleChange {
+	r.Lock()
+	defer r.Unlock()
+
+	ch := make(chan RoleChange, 16)
+	r.observers = append(r.observers, ch)
+	return ch
 }
 
-func (r *Raft) RequestVoteRequestHandler(c echo.Context) error {
-	var request RequestVoteRequest
-	if err := c.Bind(&request); err != nil {
-		return err
+func (r *Raft) Status() Status {
+	r.Lock()
+	defer r.Unlock()
+	return r.metaInfo.Status
+}
+
+func (r *Raft) IsLeader() bool {
+	return r.Status() == Leader
+}
+
+func (r *Raft) Leader() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.metaInfo.LeaderID
+}
+
+func (r *Raft) MetaInfo() MetaInfo {
+	r.Lock()
+	defer r.Unlock()
+	return r.metaInfo
+}
+
+func (r *Raft) Term() int {
+	r.Lock()
+	defer r.Unlock()
+	return r.metaInfo.Term
+}
+
+func (r *Raft) Peers() []string {
+	return r.config.Peers
+}
+
+func (r *Raft) Propose(ctx context.Context, entry LogEntry) (*Future, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.stopped() {
+		return nil, ErrStopped
+	}
+	if r.metaInfo.Status != Leader {
+		return nil, ErrNotLeader
 	}
 
+	entry.Term = r.metaInfo.Term
+	entry.Timestamp = time.Now().UnixMilli()
+	if err := r.appendLog(len(r.logs), entry); err != nil {
+		return nil, err
+	}
+	index := len(r.logs) - 1
+	future := newFuture(index, entry.Term)
+	r.futures[index] = future
+
+	r.advanceCommit()
+	r.notifyReplicate()
+	return future, nil
+}
+
+func (r *Raft) HandleRequestVote(request RequestVoteRequest) RequestVoteResponse {
 	r.Lock()
-	r.metaInfo.Lock()
-	defer r.metaInfo.Unlock()
 	defer r.Unlock()
 
 	response := RequestVoteResponse{
@@ -114,116 +224,152 @@ func (r *Raft) RequestVoteRequestHandler(c echo.Context) error {
 		},
 		Success: false,
 	}
+	if err := r.checkCluster(request.ClusterID, false); err != nil {
+		return response
+	}
+
+	if request.Term > r.metaInfo.Term {
+		r.becomeFollower(request.Term, "")
+		response.Term = r.metaInfo.Term
+	}
 
 	if request.Term < r.metaInfo.Term {
-		return c.JSON(http.StatusOK, response)
+		return response
 	}
 
-	if r.metaInfo.VotedFor == -1 || request.Term > r.metaInfo.Term || r.metaInfo.VotedFor == request.CandidateID {
-		r.metaInfo.Term = request.Term
-		r.metaInfo.Status = Follower
-		r.metaInfo.VotedFor = request.CandidateID
+	lastIndex := len(r.logs) - 1
+	lastTerm := r.logs[lastIndex].Term
+	upToDate := request.LastLogTerm > lastTerm ||
+		(request.LastLogTerm == lastTerm && request.LastLogIndex >= lastIndex)
 
+	if (r.metaInfo.VotedFor == "" || r.metaInfo.VotedFor == request.CandidateID) && upToDate {
+		// A vote that is not on disk could be cast again after a restart.
+		previous := r.metaInfo.VotedFor
+		r.metaInfo.VotedFor = request.CandidateID
+		if r.persist() != nil {
+			r.metaInfo.VotedFor = previous
+			return response
+		}
+		r.lastHeartbeatTime = time.Now()
 		response.Success = true
 	}
 
-	return c.JSON(http.StatusOK, response)
+	return response
 }
 
-func (r *Raft) AddLogRequestHandler(c echo.Context) error {
-	var request AppendEntriesRequest
-	if err := c.Bind(&request); err != nil {
-		return err
-	}
-	r.metaInfo.Lock()
+func (r *Raft) HandleAppendEntries(request AppendEntriesRequest) AppendEntriesResponse {
 	r.Lock()
-	defer r.metaInfo.Unlock()
 	defer r.Unlock()
 
-	log.Printf("Received append request from %d with term %d", request.LeaderID, request.Term)
-	if request.Term < r.metaInfo.Term {
-		return c.JSON(http.StatusOK, AppendEntriesResponse{
+	log.Printf("Received append request from %s with term %d", request.LeaderID, request.Term)
+	if request.Term < r.metaInfo.Term || r.checkCluster(request.ClusterID, true) != nil {
+		return AppendEntriesResponse{
 			Base: Base{
 				Term: r.metaInfo.Term,
 			},
 			Success: false,
-		})
+		}
 	}
 
-	r.metaInfo.Term = request.Term
-	r.metaInfo.Status = Follower
-	r.metaInfo.VotedFor = -1
+	if request.Term > r.metaInfo.Term || r.metaInfo.Status != Follower || r.metaInfo.LeaderID != request.LeaderID {
+		r.becomeFollower(request.Term, request.LeaderID)
+	}
 	r.lastHeartbeatTime = time.Now()
+	r.priorityMissed = false
 
 	if request.ParentLogIndex >= len(r.logs) || r.logs[request.ParentLogIndex].Term != request.ParentLogTerm {
-		return c.JSON(http.StatusOK, AppendEntriesResponse{
+		return AppendEntriesResponse{
 			Base: Base{
 				Term: r.metaInfo.Term,
 			},
 			Success: false,
-		})
+		}
 	}
 
-	r.logs = r.logs[:request.ParentLogIndex+1]
-	r.logs = append(r.logs, request.Entries...)
-	for i := r.commitIndex + 1; i <= request.LeaderCommitIndex; i++ {
-		r.Apply(r.logs[i])
+	for i, entry := range request.Entries {
+		idx := request.ParentLogIndex + 1 + i
+		if idx < len(r.logs) && r.logs[idx].Term == entry.Term {
+			continue
+		}
+		if r.appendLog(idx, request.Entries[i:]...) != nil {
+			return AppendEntriesResponse{
+				Base: Base{
+					Term: r.metaInfo.Term,
+				},
+				Success: false,
+			}
+		}
+		break
 	}
-	r.commitIndex = request.LeaderCommitIndex
 
-	return c.JSON(http.StatusOK, AppendEntriesResponse{
+	lastNew := request.ParentLogIndex + len(request.Entries)
+	if request.LeaderCommitIndex > r.commitIndex {
+		// A heartbeat with older entries must not move commitIndex back.
+		r.commitIndex = max(r.commitIndex, min(request.LeaderCommitIndex, lastNew))
+		r.applyCommitted()
+	}
+
+	return AppendEntriesResponse{
 		Base: Base{
 			Term: r.metaInfo.Term,
 		},
 		Success: true,
-	})
-}
-
-func (r *Raft) SendRequestVoteRequest(address string, request RequestVoteRequest) (*RequestVoteResponse, error) {
-	log.Printf("Sending request vote request to %s", address)
-	request.Term = r.metaInfo.Term
-
-	requestBytes, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
 	}
+}
 
-	resp, err := r.client.Post(address+"/raft/request_vote", "application/json", bytes.NewBuffer(requestBytes))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var response RequestVoteResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+func (r *Raft) setStatus(status Status) {
+	if r.metaInfo.Status == status {
+		return
 	}
-
-	return &response, nil
+	log.Printf("Becoming %s in term %d", status, r.metaInfo.Term)
+	r.metaInfo.Status = status
+	r.notifyObservers()
 }
 
-func (r *Raft) SendAppendRequest(address string, request AppendEntriesRequest) (*AppendEntriesResponse, error) {
-	log.Printf("Sending append request to %s", address)
-	request.Term = r.metaInfo.Term
+func (r *Raft) stepDown(reason string) {
+	log.Printf("Stepping down in term %d: %s", r.metaInfo.Term, reason)
+	r.metaInfo.StepDownReason = reason
+	r.becomeFollower(r.metaInfo.Term, "")
+}
 
-	requestBytes, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
+func (r *Raft) becomeFollower(term int, leaderID string) {
+	if term > r.metaInfo.Term {
+		r.metaInfo.Term = term
+		r.metaInfo.VotedFor = ""
+		r.persist()
 	}
-
-	resp, err := r.client.Post(address+"/raft/add_log", "application/json", bytes.NewBuffer(requestBytes))
-	if err != nil {
-		return nil, err
+	wasLeader := r.metaInfo.Status == Leader
+	changed := r.metaInfo.LeaderID != leaderID
+	r.metaInfo.LeaderID = leaderID
+	if r.metaInfo.Status != Follower {
+		r.setStatus(Follower)
+	} else if changed {
+		r.notifyObservers()
 	}
-	defer resp.Body.Close()
+	if wasLeader {
+		r.failFutures(ErrLeadershipLost)
+		r.markReady()
+	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to send append request to %s", address)
+func (r *Raft) notifyObservers() {
+	change := RoleChange{
+		Term:     r.metaInfo.Term,
+		Status:   r.metaInfo.Status,
+		LeaderID: r.metaInfo.LeaderID,
+		Reason:   r.metaInfo.StepDownReason,
 	}
-	var response AppendEntriesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+	for _, ch := range r.observers {
+		select {
+		case ch <- change:
+		default:
+		}
 	}
+}
 
-	return &response, nil
+func (r *Raft) failFutures(err error) {
+	for idx, future := range r.futures {
+		future.resolve(nil, err)
+		delete(r.futures, idx)
+	}
 }
@@ -0,0 +1,354 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"raft/pkg/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnreachable = errors.New("peer unreachable")
+
+// network delivers requests between nodes in memory. A disconnected node
+// neither sends nor receives.
+type network struct {
+	mu    sync.Mutex
+	nodes map[string]*Raft
+	down  map[string]bool
+}
+
+func (n *network) peer(from, to string) (*Raft, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down[from] || n.down[to] {
+		return nil, errUnreachable
+	}
+	return n.nodes[to], nil
+}
+
+func (n *network) setDown(id string, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down[id] = down
+}
+
+type memTransport struct {
+	net *network
+	id  string
+}
+
+func (t *memTransport) RequestVote(peer string, request RequestVoteRequest) (*RequestVoteResponse, error) {
+	node, err := t.net.peer(t.id, peer)
+	if err != nil {
+		return nil, err
+	}
+	response := node.HandleRequestVote(request)
+	return &response, nil
+}
+
+func (t *memTransport) AppendEntries(peer string, request AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	node, err := t.net.peer(t.id, peer)
+	if err != nil {
+		return nil, err
+	}
+	response := node.HandleAppendEntries(request)
+	return &response, nil
+}
+
+func (t *memTransport) TimeoutNow(peer string, request TimeoutNowRequest) (*TimeoutNowResponse, error) {
+	node, err := t.net.peer(t.id, peer)
+	if err != nil {
+		return nil, err
+	}
+	response := node.HandleTimeoutNow(request)
+	return &response, nil
+}
+
+type memStore struct {
+	state *HardState
+	log   Log
+}
+
+func (s *memStore) Load() (*HardState, error) {
+	return s.state, nil
+}
+
+func (s *memStore) Save(state HardState) error {
+	s.state = &state
+	return nil
+}
+
+func (s *memStore) LoadLog() (Log, error) {
+	return append(Log{}, s.log...), nil
+}
+
+func (s *memStore) StoreLog(index int, entries Log) error {
+	s.log = append(s.log[:index-1], entries...)
+	return nil
+}
+
+// memFSM records the entries applied to it.
+type memFSM struct {
+	mu      sync.Mutex
+	applied []LogEntry
+}
+
+func (f *memFSM) Apply(index int, entry LogEntry) (any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.applied = append(f.applied, entry)
+	return index, nil
+}
+
+func (f *memFSM) AppliedIndex() int {
+	return 0
+}
+
+func (f *memFSM) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0)
+	for _, entry := range f.applied {
+		if entry.Key != "" {
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys
+}
+
+const testConfig = `
+nodes:
+  - {id: n1, address: "localhost:1"}
+  - {id: n2, address: "localhost:2"}
+  - {id: n3, address: "localhost:3"}
+data_dir: %s
+vote_duration: {min: 150, max: 300}
+timeout:
+  leader: {heartbeat: 20}
+  follower: {leader_heartbeat: 200}
+  response: 1000
+  session: 60000
+`
+
+func testNodeConfig(t *testing.T, id string) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(testConfig, t.TempDir())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RAFT_ID", id)
+	c, err := config.NewConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+type cluster struct {
+	net   *network
+	nodes map[string]*Raft
+	fsms  map[string]*memFSM
+}
+
+// newCluster starts three nodes and bootstraps the cluster from n1.
+func newCluster(t *testing.T) *cluster {
+	t.Helper()
+	c := &cluster{
+		net:   &network{nodes: make(map[string]*Raft), down: make(map[string]bool)},
+		nodes: make(map[string]*Raft),
+		fsms:  make(map[string]*memFSM),
+	}
+	for _, id := range []string{"n1", "n2", "n3"} {
+		fsm := &memFSM{}
+		node, err := NewRaft(testNodeConfig(t, id), &memTransport{net: c.net, id: id}, fsm, &memStore{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.nodes[id] = node
+		c.fsms[id] = fsm
+	}
+	c.net.mu.Lock()
+	for id, node := range c.nodes {
+		c.net.nodes[id] = node
+	}
+	c.net.mu.Unlock()
+	for _, node := range c.nodes {
+		node.Start()
+		t.Cleanup(node.Stop)
+	}
+	if err := c.nodes["n1"].Bootstrap(NewClusterID()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// leader returns the one connected leader of the highest term, or nil.
+func (c *cluster) leader() *Raft {
+	var leader *Raft
+	for id, node := range c.nodes {
+		if c.net.down[id] || !node.IsLeader() {
+			continue
+		}
+		if leader == nil || node.Term() > leader.Term() {
+			leader = node
+		}
+	}
+	return leader
+}
+
+func (c *cluster) waitLeader(t *testing.T) *Raft {
+	t.Helper()
+	var leader *Raft
+	waitFor(t, "a leader", func() bool {
+		c.net.mu.Lock()
+		defer c.net.mu.Unlock()
+		leader = c.leader()
+		return leader != nil
+	})
+	return leader
+}
+
+func TestElectionAgreesOnLeader(t *testing.T) {
+	c := newCluster(t)
+	leader := c.waitLeader(t)
+	id := leader.config.ID
+
+	waitFor(t, "followers to follow "+id, func() bool {
+		for _, node := range c.nodes {
+			if node.Leader() != id || node.Term() != leader.Term() {
+				return false
+			}
+		}
+		return true
+	})
+	for _, node := range c.nodes {
+		if node != leader && node.IsLeader() {
+			t.Fatalf("%s and %s both lead", id, node.config.ID)
+		}
+	}
+}
+
+func TestCommitReachesEveryNode(t *testing.T) {
+	c := newCluster(t)
+	leader := c.waitLeader(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := leader.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := leader.Replicate(ctx, LogEntry{Command: OpCreate, Key: key}); err != nil {
+			t.Fatalf("replicate %s: %v", key, err)
+		}
+	}
+	for id, fsm := range c.fsms {
+		waitFor(t, id+" to apply every entry", func() bool {
+			return fmt.Sprint(fsm.keys()) == "[a b c]"
+		})
+	}
+}
+
+func TestLeaderStepsDownWithoutQuorum(t *testing.T) {
+	c := newCluster(t)
+	old := c.waitLeader(t)
+	term := old.Term()
+
+	c.net.setDown(old.config.ID, true)
+	waitFor(t, "the isolated leader to step down", func() bool {
+		return !old.IsLeader()
+	})
+	if reason := old.MetaInfo().StepDownReason; reason == "" {
+		t.Fatal("step-down has no reason")
+	}
+
+	// Entries proposed now can not commit without a quorum.
+	if _, err := old.Propose(context.Background(), LogEntry{Command: OpCreate, Key: "lost"}); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("propose on stepped-down leader: got %v, want %v", err, ErrNotLeader)
+	}
+
+	leader := c.waitLeader(t)
+	if leader == old || leader.Term() <= term {
+		t.Fatalf("new leader %s in term %d, old term %d", leader.config.ID, leader.Term(), term)
+	}
+
+	c.net.setDown(old.config.ID, false)
+	waitFor(t, "the old leader to rejoin", func() bool {
+		return old.Leader() == leader.config.ID && old.Term() >= leader.Term()
+	})
+}
+
+func TestAppendKeepsCommitIndexOnStaleRequest(t *testing.T) {
+	fsm := &memFSM{}
+	node, err := NewRaft(testNodeConfig(t, "n2"), &memTransport{net: &network{}, id: "n2"}, fsm, &memStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := Log{
+		{Base: Base{Term: 1}, Command: OpNoop},
+		{Base: Base{Term: 1}, Command: OpCreate, Key: "a"},
+		{Base: Base{Term: 1}, Command: OpCreate, Key: "b"},
+	}
+	node.HandleAppendEntries(AppendEntriesRequest{
+		Base:              Base{Term: 1},
+		LeaderID:          "n1",
+		Entries:           entries,
+		LeaderCommitIndex: 2,
+	})
+	// A heartbeat sent before the entries above arrives late.
+	response := node.HandleAppendEntries(AppendEntriesRequest{
+		Base:              Base{Term: 1},
+		LeaderID:          "n1",
+		ParentLogIndex:    1,
+		ParentLogTerm:     1,
+		LeaderCommitIndex: 3,
+	})
+	if !response.Success {
+		t.Fatal("stale heartbeat was rejected")
+	}
+	node.Lock()
+	commitIndex := node.commitIndex
+	node.Unlock()
+	if commitIndex != 2 {
+		t.Fatalf("commit index: got %d, want 2", commitIndex)
+	}
+}
+
+func TestPriorityDelaySkipsVotersThatMissedTheirTurn(t *testing.T) {
+	node, err := NewRaft(testNodeConfig(t, "n2"), &memTransport{net: &network{}, id: "n2"}, &memFSM{}, &memStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.config.Priorities = map[string]int{"n1": 3, "n2": 1, "n3": 2}
+	wait := node.config.FollowerHeartbeatWaiting
+
+	node.HandleAppendEntries(AppendEntriesRequest{Base: Base{Term: 1}, LeaderID: "n3"})
+	if got := node.priorityDelay(); got != wait/2 {
+		t.Fatalf("delay while following n3: got %s, want %s", got, wait/2)
+	}
+	node.priorityMissed = true
+	if got := node.priorityDelay(); got != 0 {
+		t.Fatalf("delay after an election without them: got %s, want 0", got)
+	}
+	node.HandleAppendEntries(AppendEntriesRequest{Base: Base{Term: 2}, LeaderID: "n1"})
+	if got := node.priorityDelay(); got != wait/2 {
+		t.Fatalf("delay while following n1: got %s, want %s", got, wait/2)
+	}
+}
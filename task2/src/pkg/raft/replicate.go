@@ -1,70 +1,74 @@
 package raft
 
 import (
-	"errors"
-
-	"github.com/labstack/gommon/log"
+	"context"
 )
 
-func (r *Raft) Replicate(entry LogEntry) error {
+// WaitReady blocks until this node is leader and the no-op entry of its
+// term is applied, so entries from previous terms are visible.
+func (r *Raft) WaitReady(ctx context.Context) error {
 	r.Lock()
-	defer r.Unlock()
-
-	entry.Term = r.metaInfo.Term
-	r.logs = append(r.logs, entry)
-	results := make(chan bool, len(r.config.OtherPorts))
+	if r.metaInfo.Status != Leader {
+		r.Unlock()
+		return ErrNotLeader
+	}
+	ready := r.ready
+	r.Unlock()
 
-	for _, port := range r.config.OtherPorts {
-		go func(port int) {
-			req := AppendEntriesRequest{
-				Entries:           []LogEntry{entry},
-				ParentLogIndex:    len(r.logs) - 2,
-				ParentLogTerm:     r.logs[len(r.logs)-2].Term,
-				LeaderCommitIndex: r.commitIndex,
-				LeaderID:          r.config.ServerPort,
-			}
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if !r.IsLeader() {
+		return ErrNotLeader
+	}
+	return nil
+}
 
-			succ, err := r.SendAppendRequest(GetAddress(port), req)
-			if err != nil {
-				results <- false
-				return
-			}
-			results <- succ.Success
-		}(port)
+func (r *Raft) markReady() {
+	select {
+	case <-r.ready:
+	default:
+		close(r.ready)
 	}
+}
 
-	acked := 0
-	for i := 0; i < len(r.config.OtherPorts); i++ {
-		if <-results {
-			acked++
-		}
+func (r *Raft) Replicate(ctx context.Context, entry LogEntry) (any, error) {
+	future, err := r.Propose(ctx, entry)
+	if err != nil {
+		return nil, err
 	}
-	if acked*2 > len(r.config.OtherPorts) {
-		for i := r.commitIndex + 1; i < len(r.logs); i++ {
-			r.Apply(r.logs[i])
-		}
-		for key := range r.syncedIdx {
-			r.syncedIdx[key]++
-		}
-		r.commitIndex = len(r.logs) - 1
-		return nil
+	return future.Wait(ctx)
+}
+
+// Apply hands every committed entry to the state machine, the ones that
+// change no data included, so its applied index keeps up with the log.
+func (r *Raft) Apply(index int, entry LogEntry) (any, error) {
+	if r.config.Witness {
+		return nil, nil
 	}
-	r.logs = r.logs[:len(r.logs)-1]
-	return errors.New("failed to replicate")
+	return r.fsm.Apply(index, entry)
 }
 
-func (r *Raft) Apply(entry LogEntry) error {
-	switch entry.Command {
-	case OpCreate:
-		return r.storage.Create(entry.Key, *entry.Value)
-	case OpSet:
-		return r.storage.Set(entry.Key, *entry.Value)
-	case OpCAS:
-		return r.storage.CAS(entry.Key, *entry.CompareValue, *entry.Value)
-	case OpDelete:
-		return r.storage.Delete(entry.Key)
-	default:
-		log.Warnf("Got strange command number: %d", entry.Command)
+func (r *Raft) applyCommitted() {
+	for r.lastApplied < r.commitIndex {
+		r.lastApplied++
+		entry := r.logs[r.lastApplied]
+		result, err := r.Apply(r.lastApplied, entry)
+		if r.lastApplied == r.noopIndex && r.metaInfo.Status == Leader {
+			r.markReady()
+		}
+
+		future, ok := r.futures[r.lastApplied]
+		if !ok {
+			continue
+		}
+		delete(r.futures, r.lastApplied)
+		if future.term != entry.Term {
+			future.resolve(nil, ErrLeadershipLost)
+			continue
+		}
+		future.resolve(result, err)
 	}
-	return nil
 }
@@ -0,0 +1,168 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type HardState struct {
+	ClusterID string   `json:"cluster_id"`
+	Members   []string `json:"members"`
+	Term      int      `json:"term"`
+	VotedFor  string   `json:"voted_for"`
+}
+
+type StableStore interface {
+	// Load returns nil if nothing was saved yet.
+	Load() (*HardState, error)
+	Save(state HardState) error
+
+	// LoadLog returns the entries after the initial one.
+	LoadLog() (Log, error)
+	// StoreLog replaces everything from index onward with entries.
+	StoreLog(index int, entries Log) error
+}
+
+type FileStore struct {
+	path string
+
+	logPath    string
+	logFile    *os.File
+	logOffsets []int64
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{
+		path:       filepath.Join(dir, "raft.json"),
+		logPath:    filepath.Join(dir, "log.jsonl"),
+		logOffsets: []int64{0, 0},
+	}, nil
+}
+
+func (s *FileStore) Load() (*HardState, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state HardState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *FileStore) Save(state HardState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileStore) LoadLog() (Log, error) {
+	f, err := os.OpenFile(s.logPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(Log, 0)
+	offset := int64(0)
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A partial last line is a write torn by a crash.
+			break
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("corrupted log entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+		offset += int64(len(line))
+		s.logOffsets = append(s.logOffsets, offset)
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.logFile = f
+	return entries, nil
+}
+
+func (s *FileStore) StoreLog(index int, entries Log) error {
+	if s.logFile == nil {
+		if _, err := s.LoadLog(); err != nil {
+			return err
+		}
+	}
+	if index < 1 || index >= len(s.logOffsets) {
+		return fmt.Errorf("log index %d out of range", index)
+	}
+	if index < len(s.logOffsets)-1 {
+		if err := s.logFile.Truncate(s.logOffsets[index]); err != nil {
+			return err
+		}
+		if _, err := s.logFile.Seek(s.logOffsets[index], 0); err != nil {
+			return err
+		}
+		s.logOffsets = s.logOffsets[:index+1]
+	}
+
+	var buf []byte
+	offset := s.logOffsets[index]
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+		offset += int64(len(data) + 1)
+		s.logOffsets = append(s.logOffsets, offset)
+	}
+	if _, err := s.logFile.Write(buf); err != nil {
+		return err
+	}
+	return s.logFile.Sync()
+}
+
+func (s *FileStore) Close() error {
+	if s.logFile == nil {
+		return nil
+	}
+	return s.logFile.Close()
+}
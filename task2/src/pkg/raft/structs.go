@@ -9,6 +9,24 @@ const (
 	OpSet
 	OpCAS
 	OpDelete
+	OpRegisterClient
+	OpExpireSessions
+	OpNoop
+	OpCompact
+	OpTxn
+	OpExpireKeys
+	OpGrantLease
+	OpKeepAlive
+	OpRevokeLease
+	OpExpireLeases
+	OpAcquireLock
+	OpReleaseLock
+	OpIncrement
+	OpDecrement
+	OpBatch
+	OpCreateNamespace
+	OpDropNamespace
+	OpImport
 )
 
 type Base struct {
@@ -17,36 +35,113 @@ type Base struct {
 
 type LogEntry struct {
 	Base
+	Command      OpCode   `json:"command"`
+	Key          string   `json:"key"`
+	Value        *string  `json:"value"`
+	CompareValue *string  `json:"compare_value"`
+	Revision     int      `json:"revision,omitempty"`
+	Txn          *Txn     `json:"txn,omitempty"`
+	Ops          []TxnOp  `json:"ops,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+	MaxKeys      int      `json:"max_keys,omitempty"`
+	MaxBytes     int64    `json:"max_bytes,omitempty"`
+	TTL          int64    `json:"ttl,omitempty"`
+	Keys         []string `json:"keys,omitempty"`
+	Lease        int      `json:"lease,omitempty"`
+	Leases       []int    `json:"leases,omitempty"`
+	Delta        int64    `json:"delta,omitempty"`
+	Min          *int64   `json:"min,omitempty"`
+	Max          *int64   `json:"max,omitempty"`
+	Create       bool     `json:"create,omitempty"`
+	ContentType  string   `json:"content_type,omitempty"`
+	IfMatch      []string `json:"if_match,omitempty"`
+	IfNoneMatch  []string `json:"if_none_match,omitempty"`
+
+	ClientID  int   `json:"client_id,omitempty"`
+	Sequence  int   `json:"sequence,omitempty"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Metadata drops the payload of the entry, leaving what a witness needs
+// to take part in log matching.
+func (e LogEntry) Metadata() LogEntry {
+	return LogEntry{
+		Base:    e.Base,
+		Command: e.Command,
+	}
+}
+
+type Compare struct {
+	Key string `json:"key"`
+	// Target is "value", "exists" or "version".
+	Target string `json:"target"`
+	// Op is one of ==, !=, <, >; exists only supports == and !=.
+	Op      string `json:"op"`
+	Value   string `json:"value,omitempty"`
+	Exists  bool   `json:"exists,omitempty"`
+	Version int    `json:"version,omitempty"`
+}
+
+type TxnOp struct {
 	Command      OpCode  `json:"command"`
 	Key          string  `json:"key"`
-	Value        *string `json:"value"`
-	CompareValue *string `json:"compare_value"`
+	Value        *string `json:"value,omitempty"`
+	CompareValue *string `json:"compare_value,omitempty"`
+	TTL          int64   `json:"ttl,omitempty"`
+	Lease        int     `json:"lease,omitempty"`
+	ContentType  string  `json:"content_type,omitempty"`
+}
+
+// Txn runs Success if every comparison holds and Failure otherwise.
+type Txn struct {
+	Compare []Compare `json:"compare"`
+	Success []TxnOp   `json:"success"`
+	Failure []TxnOp   `json:"failure"`
 }
 
 type Log = []LogEntry
 
 type AppendEntriesRequest struct {
 	Base
-	Entries           Log `json:"entries"`
-	ParentLogIndex    int `json:"parent_log_index"`
-	ParentLogTerm     int `json:"parent_log_term"`
-	LeaderCommitIndex int `json:"leader_commit_index"`
-	LeaderID          int `json:"leader_id"`
+	GroupID           int    `json:"group_id"`
+	ClusterID         string `json:"cluster_id"`
+	Entries           Log    `json:"entries"`
+	ParentLogIndex    int    `json:"parent_log_index"`
+	ParentLogTerm     int    `json:"parent_log_term"`
+	LeaderCommitIndex int    `json:"leader_commit_index"`
+	LeaderID          string `json:"leader_id"`
 }
 
 type AppendEntriesResponse struct {
 	Base
 	Success bool `json:"success"`
+	// Error is set in a batch response when the request could not be
+	// handled at all, like one for a group the peer does not have.
+	Error string `json:"error,omitempty"`
 }
 
 type RequestVoteRequest struct {
 	Base
-	CandidateID  int `json:"candidate_id"`
-	LastLogIndex int `json:"last_log_index"`
-	LastLogTerm  int `json:"last_log_term"`
+	GroupID      int    `json:"group_id"`
+	ClusterID    string `json:"cluster_id"`
+	CandidateID  string `json:"candidate_id"`
+	LastLogIndex int    `json:"last_log_index"`
+	LastLogTerm  int    `json:"last_log_term"`
 }
 
 type RequestVoteResponse struct {
 	Base
 	Success bool `json:"success"`
 }
+
+type TimeoutNowRequest struct {
+	Base
+	GroupID   int    `json:"group_id"`
+	ClusterID string `json:"cluster_id"`
+	LeaderID  string `json:"leader_id"`
+}
+
+type TimeoutNowResponse struct {
+	Base
+	Success bool `json:"success"`
+}
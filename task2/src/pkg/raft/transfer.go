@@ -0,0 +1,110 @@
+package raft
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrTransferTarget = errors.New("transfer target is not a caught-up voter")
+
+// TransferLeadership asks a caught-up peer to start an election right away.
+func (r *Raft) TransferLeadership(peer string) error {
+	r.Lock()
+	if r.metaInfo.Status != Leader {
+		r.Unlock()
+		return ErrNotLeader
+	}
+	if r.config.Witnesses[peer] || r.matchIdx[peer] != len(r.logs)-1 {
+		r.Unlock()
+		return ErrTransferTarget
+	}
+	r.lastTransfer = time.Now()
+	req := TimeoutNowRequest{
+		Base: Base{
+			Term: r.metaInfo.Term,
+		},
+		ClusterID: r.clusterID,
+		LeaderID:  r.config.ID,
+	}
+	r.Unlock()
+
+	log.Printf("Transferring leadership to %s", peer)
+	res, err := r.transport.TimeoutNow(peer, req)
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return ErrTransferTarget
+	}
+	return nil
+}
+
+func (r *Raft) HandleTimeoutNow(request TimeoutNowRequest) TimeoutNowResponse {
+	r.Lock()
+	defer r.Unlock()
+
+	response := TimeoutNowResponse{
+		Base: Base{
+			Term: r.metaInfo.Term,
+		},
+	}
+	if request.Term != r.metaInfo.Term || r.metaInfo.Status != Follower || r.config.Witness || request.ClusterID != r.clusterID {
+		return response
+	}
+
+	response.Success = true
+	go r.BecomeCandidate()
+	return response
+}
+
+// preferredPeer returns a healthy, caught-up peer whose priority is higher
+// than ours, or "".
+func (r *Raft) preferredPeer() string {
+	best, bestPriority := "", r.config.Priority()
+	for _, peer := range r.config.Peers {
+		priority := r.config.Priorities[peer]
+		if priority <= bestPriority || r.config.Witnesses[peer] {
+			continue
+		}
+		if time.Since(r.lastAck[peer]) >= r.config.FollowerHeartbeatWaiting || r.matchIdx[peer] != len(r.logs)-1 {
+			continue
+		}
+		best, bestPriority = peer, priority
+	}
+	return best
+}
+
+func (r *Raft) checkPreferredLeader() {
+	if time.Since(r.lastTransfer) < r.config.FollowerHeartbeatWaiting {
+		return
+	}
+	peer := r.preferredPeer()
+	if peer == "" {
+		return
+	}
+	r.lastTransfer = time.Now()
+	go func() {
+		if err := r.TransferLeadership(peer); err != nil {
+			log.Printf("Failed to transfer leadership to %s: %v", peer, err)
+		}
+	}()
+}
+
+// priorityDelay lengthens the election timeout by half a heartbeat wait for
+// every voter with a higher priority that may still run first. The leader
+// that went silent will not, and once an election started without them,
+// none of them gets waited for again until a leader is heard from.
+func (r *Raft) priorityDelay() time.Duration {
+	if r.priorityMissed {
+		return 0
+	}
+	higher := 0
+	for _, peer := range r.config.Peers {
+		if peer == r.metaInfo.LeaderID || r.config.Witnesses[peer] || r.config.Priorities[peer] <= r.config.Priority() {
+			continue
+		}
+		higher++
+	}
+	return time.Duration(higher) * r.config.FollowerHeartbeatWaiting / 2
+}
@@ -0,0 +1,163 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const coalesceWindow = 2 * time.Millisecond
+
+type Transport interface {
+	RequestVote(peer string, request RequestVoteRequest) (*RequestVoteResponse, error)
+	AppendEntries(peer string, request AppendEntriesRequest) (*AppendEntriesResponse, error)
+	TimeoutNow(peer string, request TimeoutNowRequest) (*TimeoutNowResponse, error)
+}
+
+// HTTPTransport is shared by all groups of a process. Append requests sent
+// to the same peer within coalesceWindow are delivered in one batch.
+type HTTPTransport struct {
+	client    *http.Client
+	addresses map[string]string
+
+	mu      sync.Mutex
+	pending map[string][]*pendingAppend
+}
+
+type pendingAppend struct {
+	request AppendEntriesRequest
+	done    chan appendResult
+}
+
+type appendResult struct {
+	response *AppendEntriesResponse
+	err      error
+}
+
+func NewHTTPTransport(timeout time.Duration, addresses map[string]string) *HTTPTransport {
+	return &HTTPTransport{
+		client:    &http.Client{Timeout: timeout},
+		addresses: addresses,
+		pending:   make(map[string][]*pendingAppend),
+	}
+}
+
+func (t *HTTPTransport) Address(peer string) string {
+	return "http://" + t.addresses[peer]
+}
+
+func (t *HTTPTransport) Group(groupID int) Transport {
+	return &groupTransport{
+		shared:  t,
+		groupID: groupID,
+	}
+}
+
+func (t *HTTPTransport) RequestVote(peer string, request RequestVoteRequest) (*RequestVoteResponse, error) {
+	log.Printf("Sending request vote request to %s", peer)
+	var response RequestVoteResponse
+	if err := t.post(t.Address(peer)+"/raft/request_vote", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (t *HTTPTransport) TimeoutNow(peer string, request TimeoutNowRequest) (*TimeoutNowResponse, error) {
+	log.Printf("Sending timeout now request to %s", peer)
+	var response TimeoutNowResponse
+	if err := t.post(t.Address(peer)+"/raft/timeout_now", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (t *HTTPTransport) AppendEntries(peer string, request AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	p := &pendingAppend{
+		request: request,
+		done:    make(chan appendResult, 1),
+	}
+
+	t.mu.Lock()
+	queue, ok := t.pending[peer]
+	t.pending[peer] = append(queue, p)
+	if !ok {
+		time.AfterFunc(coalesceWindow, func() {
+			t.flush(peer)
+		})
+	}
+	t.mu.Unlock()
+
+	res := <-p.done
+	return res.response, res.err
+}
+
+func (t *HTTPTransport) flush(peer string) {
+	t.mu.Lock()
+	batch := t.pending[peer]
+	delete(t.pending, peer)
+	t.mu.Unlock()
+
+	log.Printf("Sending %d append requests to %s", len(batch), peer)
+	requests := make([]AppendEntriesRequest, len(batch))
+	for i, p := range batch {
+		requests[i] = p.request
+	}
+
+	var responses []AppendEntriesResponse
+	err := t.post(t.Address(peer)+"/raft/add_log_batch", requests, &responses)
+	if err == nil && len(responses) != len(batch) {
+		err = fmt.Errorf("got %d responses for %d append requests", len(responses), len(batch))
+	}
+	for i, p := range batch {
+		switch {
+		case err != nil:
+			p.done <- appendResult{err: err}
+		case responses[i].Error != "":
+			p.done <- appendResult{err: fmt.Errorf("%s: %s", peer, responses[i].Error)}
+		default:
+			p.done <- appendResult{response: &responses[i]}
+		}
+	}
+}
+
+func (t *HTTPTransport) post(url string, request any, response any) error {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(url, "application/json", bytes.NewBuffer(requestBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed with status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+type groupTransport struct {
+	shared  *HTTPTransport
+	groupID int
+}
+
+func (t *groupTransport) RequestVote(peer string, request RequestVoteRequest) (*RequestVoteResponse, error) {
+	request.GroupID = t.groupID
+	return t.shared.RequestVote(peer, request)
+}
+
+func (t *groupTransport) AppendEntries(peer string, request AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	request.GroupID = t.groupID
+	return t.shared.AppendEntries(peer, request)
+}
+
+func (t *groupTransport) TimeoutNow(peer string, request TimeoutNowRequest) (*TimeoutNowResponse, error) {
+	request.GroupID = t.groupID
+	return t.shared.TimeoutNow(peer, request)
+}
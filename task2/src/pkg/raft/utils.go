@@ -1,7 +1,7 @@
 package raft
 
 import (
-	"fmt"
+	"raft/pkg/config"
 	"sync"
 )
 
@@ -28,6 +28,14 @@ func (ai *AtomicInt) Inc(n int) {
 	ai.value += n
 }
 
-func GetAddress(port int) string {
-	return fmt.Sprintf("http://raft%d:%d", port-8080, port)
+// ScopedID numbers something, like a client session or a lease, by the
+// index of the entry of group that made it. Every group numbers its own
+// log, so the group goes into the ID to keep it unique across the cluster.
+func ScopedID(group, index int) int {
+	return index*(config.MaxGroupID+1) + group
+}
+
+// IDGroup returns the group that handed out a ScopedID.
+func IDGroup(id int) int {
+	return id % (config.MaxGroupID + 1)
 }
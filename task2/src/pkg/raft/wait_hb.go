@@ -8,92 +8,132 @@ import (
 
 func (r *Raft) WaitHeartbeat() {
 	for {
-		time.Sleep(time.Millisecond * 100)
-		r.Lock()
-		r.metaInfo.Lock()
-
-		if r.metaInfo.Status == Candidate && time.Since(r.lastTry) < r.electionTimeout {
-			r.metaInfo.Unlock()
-			r.Unlock()
-			continue
-		}
-		if r.metaInfo.Status == Candidate {
-			r.BecomeCandidate()
-			r.lastTry = time.Now()
-			r.electionTimeout = r.config.GetVoteDuration()
-			r.metaInfo.Unlock()
-			r.Unlock()
-			continue
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(time.Millisecond * 100):
 		}
 
-		if r.metaInfo.Status != Follower || time.Since(r.lastHeartbeatTime) < r.config.FollowerHeartbeatWaiting {
-			if r.metaInfo.Status != Follower {
-				r.lastHeartbeatTime = time.Now()
+		r.Lock()
+		switch r.metaInfo.Status {
+		case Leader:
+			r.lastHeartbeatTime = time.Now()
+			r.checkQuorum()
+			if r.metaInfo.Status == Leader {
+				r.checkPreferredLeader()
 			}
 			r.Unlock()
-			r.metaInfo.Unlock()
 			continue
+		case Candidate:
+			if time.Since(r.lastTry) < r.electionTimeout {
+				r.Unlock()
+				continue
+			}
+		case Follower:
+			if r.config.Witness || r.clusterID == "" || time.Since(r.lastHeartbeatTime) < r.config.FollowerHeartbeatWaiting+r.priorityDelay() {
+				r.Unlock()
+				continue
+			}
+			log.Printf("Starting election")
+			r.priorityMissed = true
 		}
-
-		log.Printf("Starting election")
+		r.Unlock()
 
 		r.BecomeCandidate()
-		if r.metaInfo.Status == Candidate {
-			r.lastTry = time.Now()
-			r.electionTimeout = r.config.GetVoteDuration()
-			log.Printf("Election timeout: %s", r.electionTimeout)
-		}
-
-		r.metaInfo.Unlock()
-		r.Unlock()
 	}
 }
 
 func (r *Raft) BecomeCandidate() {
-	r.metaInfo.Status = Candidate
-	r.metaInfo.VotedFor = r.config.ServerPort
+	r.Lock()
 	r.metaInfo.Term++
+	r.metaInfo.VotedFor = r.config.ID
+	r.metaInfo.LeaderID = ""
+	if r.persist() != nil {
+		// Without our own vote on disk we could vote again in this term.
+		r.Unlock()
+		return
+	}
+	r.setStatus(Candidate)
+	r.lastTry = time.Now()
+	r.electionTimeout = r.config.GetVoteDuration()
+	log.Printf("Election timeout: %s", r.electionTimeout)
 
+	term := r.metaInfo.Term
 	req := RequestVoteRequest{
 		Base: Base{
-			Term: r.metaInfo.Term,
+			Term: term,
 		},
-		CandidateID:  r.config.ServerPort,
+		ClusterID:    r.clusterID,
+		CandidateID:  r.config.ID,
 		LastLogIndex: len(r.logs) - 1,
 		LastLogTerm:  r.logs[len(r.logs)-1].Term,
 	}
+	r.Unlock()
 
 	results := []RequestVoteResponse{}
 	mtx := sync.Mutex{}
 	wg := sync.WaitGroup{}
-	for _, port := range r.config.OtherPorts {
+	for _, peer := range r.config.Peers {
 		wg.Add(1)
-		go func(port int) {
+		go func(peer string) {
 			defer wg.Done()
-			res, err := r.SendRequestVoteRequest(GetAddress(port), req)
+			res, err := r.transport.RequestVote(peer, req)
 			if err != nil {
 				return
 			}
 			mtx.Lock()
 			results = append(results, *res)
 			mtx.Unlock()
-		}(port)
+		}(peer)
 	}
 	wg.Wait()
 
+	r.Lock()
+	defer r.Unlock()
+
+	if r.metaInfo.Term != term || r.metaInfo.Status != Candidate {
+		return
+	}
+
 	acked := 1
 	for _, res := range results {
-		if res.Success {
-			acked++
-		}
 		if res.Term > r.metaInfo.Term {
-			r.metaInfo.Status = Follower
-			r.metaInfo.Term = res.Term
+			r.becomeFollower(res.Term, "")
 			return
 		}
+		if res.Success {
+			acked++
+		}
 	}
 
-	if acked*2 > len(r.config.OtherPorts) {
-		r.metaInfo.Status = Leader
+	if acked*2 > len(r.config.Peers)+1 {
+		r.becomeLeader()
+	}
+}
+
+func (r *Raft) becomeLeader() {
+	r.metaInfo.LeaderID = r.config.ID
+	for _, peer := range r.config.Peers {
+		r.syncedIdx[peer] = len(r.logs) - 1
+		r.matchIdx[peer] = 0
+		r.lastAck[peer] = time.Now()
+	}
+	r.metaInfo.StepDownReason = ""
+	r.setStatus(Leader)
+
+	r.ready = make(chan struct{})
+	err := r.appendLog(len(r.logs), LogEntry{
+		Base: Base{
+			Term: r.metaInfo.Term,
+		},
+		Command:   OpNoop,
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		r.stepDown("failed to persist the no-op entry")
+		return
 	}
+	r.noopIndex = len(r.logs) - 1
+	r.advanceCommit()
+	r.notifyReplicate()
 }
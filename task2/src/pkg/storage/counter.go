@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNotNumber   = errors.New("value is not an integer")
+	ErrOutOfBounds = errors.New("result is out of bounds")
+)
+
+// CounterOptions bound the result of Add. With Create a missing key counts
+// as 0 and is written with the embedded WriteOptions.
+type CounterOptions struct {
+	WriteOptions
+	Min    *int64
+	Max    *int64
+	Create bool
+}
+
+// Add adds delta to the integer stored at key and returns the new value.
+// A result past the bounds or overflowing int64 leaves the key untouched.
+func (tx *Tx) Add(key string, delta int64, opts CounterOptions) (int64, error) {
+	var value int64
+	current, err := tx.Get(key)
+	found := err == nil
+	switch {
+	case found:
+		if value, err = strconv.ParseInt(current.Value, 10, 64); err != nil {
+			return 0, ErrNotNumber
+		}
+	case errors.Is(err, ErrKeyNotFound) && opts.Create:
+		if err := tx.checkLease(opts.Lease); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+
+	if delta > 0 && value > math.MaxInt64-delta || delta < 0 && value < math.MinInt64-delta {
+		return 0, ErrOutOfBounds
+	}
+	value += delta
+	if opts.Min != nil && value < *opts.Min || opts.Max != nil && value > *opts.Max {
+		return 0, ErrOutOfBounds
+	}
+
+	formatted := strconv.FormatInt(value, 10)
+	if !found {
+		return value, tx.write(key, Version{Op: EventCreate, Value: formatted, ExpiresAt: opts.ExpiresAt, Lease: opts.Lease, ContentType: opts.ContentType})
+	}
+	return value, tx.write(key, Version{Op: EventUpdate, Value: formatted, ExpiresAt: current.ExpiresAt, Lease: current.Lease, ContentType: current.ContentType})
+}
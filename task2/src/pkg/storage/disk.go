@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	recordPut byte = iota + 1
+	recordDelete
+	recordCommit
+)
+
+const (
+	headerSize = 13
+
+	compactInterval   = 30 * time.Second
+	compactMinGarbage = 4 << 20
+)
+
+type valuePos struct {
+	offset int64
+	length int
+	size   int64
+}
+
+// DiskEngine keeps every write in an append-only data file and an in-memory
+// index from key to the latest value. Writes after the last commit record
+// are dropped on recovery, so an entry is applied either fully or not at all.
+type DiskEngine struct {
+	mu sync.Mutex
+
+	path    string
+	file    *os.File
+	size    int64
+	index   map[string]valuePos
+	garbage int64
+	applied int
+
+	lastCommit int64
+	dirty      bool
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func NewDiskEngine(dir string) (*DiskEngine, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	e := &DiskEngine{
+		path:  filepath.Join(dir, "data.db"),
+		index: make(map[string]valuePos),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	log.Printf("Opened data file %s with %d keys, applied up to %d", e.path, len(e.index), e.applied)
+
+	go e.compactLoop()
+	return e, nil
+}
+
+func encodeRecord(kind byte, key, value string) []byte {
+	buf := make([]byte, headerSize+len(key)+len(value))
+	buf[4] = kind
+	binary.LittleEndian.PutUint32(buf[5:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[9:], uint32(len(value)))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func encodeIndex(index int) string {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(index))
+	return string(buf)
+}
+
+// open rebuilds the index from the data file and cuts off the writes of an
+// entry that was not committed before a crash.
+func (e *DiskEngine) open() error {
+	f, err := os.OpenFile(e.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	type op struct {
+		kind byte
+		key  string
+		pos  valuePos
+	}
+	var pending []op
+	offset := int64(0)
+	reader := bufio.NewReader(f)
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		klen := int(binary.LittleEndian.Uint32(header[5:]))
+		vlen := int(binary.LittleEndian.Uint32(header[9:]))
+		body := make([]byte, klen+vlen)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			break
+		}
+		sum := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, body)
+		if sum != binary.LittleEndian.Uint32(header) {
+			log.Printf("Data file %s has a corrupted record at offset %d", e.path, offset)
+			break
+		}
+
+		size := int64(headerSize + klen + vlen)
+		kind := header[4]
+		switch kind {
+		case recordPut, recordDelete:
+			pending = append(pending, op{
+				kind: kind,
+				key:  string(body[:klen]),
+				pos: valuePos{
+					offset: offset + headerSize + int64(klen),
+					length: vlen,
+					size:   size,
+				},
+			})
+		case recordCommit:
+			for _, o := range pending {
+				if o.kind == recordPut {
+					e.setIndex(o.key, o.pos)
+				} else {
+					e.deleteIndex(o.key, o.pos.size)
+				}
+			}
+			pending = pending[:0]
+			e.garbage += e.lastCommit
+			e.lastCommit = size
+			e.applied = int(binary.LittleEndian.Uint64(body[klen:]))
+			e.size = offset + size
+		default:
+			f.Close()
+			return fmt.Errorf("unknown record type %d at offset %d", kind, offset)
+		}
+		offset += size
+	}
+
+	if err := f.Truncate(e.size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(e.size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	e.file = f
+	return nil
+}
+
+func (e *DiskEngine) setIndex(key string, pos valuePos) {
+	if old, ok := e.index[key]; ok {
+		e.garbage += old.size
+	}
+	e.index[key] = pos
+}
+
+func (e *DiskEngine) deleteIndex(key string, size int64) {
+	if old, ok := e.index[key]; ok {
+		e.garbage += old.size
+	}
+	e.garbage += size
+	delete(e.index, key)
+}
+
+// append writes buf at the end of the data file. A failed write is cut
+// off, so the next one still follows the last whole record.
+func (e *DiskEngine) append(buf []byte) error {
+	if _, err := e.file.Write(buf); err != nil {
+		if terr := e.file.Truncate(e.size); terr != nil {
+			return errors.Join(err, terr)
+		}
+		if _, serr := e.file.Seek(e.size, io.SeekStart); serr != nil {
+			return errors.Join(err, serr)
+		}
+		return err
+	}
+	e.size += int64(len(buf))
+	return nil
+}
+
+func (e *DiskEngine) Get(key string) (string, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pos, ok := e.index[key]
+	if !ok {
+		return "", false, nil
+	}
+	buf := make([]byte, pos.length)
+	if _, err := e.file.ReadAt(buf, pos.offset); err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
+
+func (e *DiskEngine) Put(key, value string) error {
+	return e.WriteBatch([]Write{{Key: key, Value: value}})
+}
+
+func (e *DiskEngine) Delete(key string) error {
+	return e.WriteBatch([]Write{{Key: key, Delete: true}})
+}
+
+// WriteBatch appends the records of writes with one write to the file.
+func (e *DiskEngine) WriteBatch(writes []Write) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var buf []byte
+	positions := make([]valuePos, len(writes))
+	for i, w := range writes {
+		kind := recordPut
+		if w.Delete {
+			kind = recordDelete
+		}
+		record := encodeRecord(kind, w.Key, w.Value)
+		positions[i] = valuePos{
+			offset: e.size + int64(len(buf)) + headerSize + int64(len(w.Key)),
+			length: len(w.Value),
+			size:   int64(len(record)),
+		}
+		buf = append(buf, record...)
+	}
+	if err := e.append(buf); err != nil {
+		return err
+	}
+	e.dirty = true
+	for i, w := range writes {
+		if w.Delete {
+			e.deleteIndex(w.Key, positions[i].size)
+		} else {
+			e.setIndex(w.Key, positions[i])
+		}
+	}
+	return nil
+}
+
+func (e *DiskEngine) Keys() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys := make([]string, 0, len(e.index))
+	for key := range e.index {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (e *DiskEngine) Commit(appliedIndex int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	record := encodeRecord(recordCommit, "", encodeIndex(appliedIndex))
+	if err := e.append(record); err != nil {
+		return err
+	}
+	e.dirty = false
+	if err := e.file.Sync(); err != nil {
+		return err
+	}
+	e.garbage += e.lastCommit
+	e.lastCommit = int64(len(record))
+	e.applied = appliedIndex
+	return nil
+}
+
+func (e *DiskEngine) AppliedIndex() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.applied
+}
+
+func (e *DiskEngine) Close() error {
+	select {
+	case <-e.stop:
+		return nil
+	default:
+	}
+	close(e.stop)
+	<-e.done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+func (e *DiskEngine) compactLoop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := e.compact(); err != nil {
+				log.Printf("Failed to compact data file: %v", err)
+			}
+		}
+	}
+}
+
+// compact rewrites the live keys into a new data file once more than half
+// of the current one is overwritten or deleted values.
+func (e *DiskEngine) compact() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Writes of a half-applied entry must stay after the last commit record.
+	if e.dirty || e.garbage < compactMinGarbage || e.garbage*2 < e.size {
+		return nil
+	}
+	before := e.size
+
+	tmp := e.path + ".compact"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	index := make(map[string]valuePos, len(e.index))
+	size := int64(0)
+	for key, pos := range e.index {
+		buf := make([]byte, pos.length)
+		if _, err := e.file.ReadAt(buf, pos.offset); err != nil {
+			f.Close()
+			return err
+		}
+		record := encodeRecord(recordPut, key, string(buf))
+		if _, err := writer.Write(record); err != nil {
+			f.Close()
+			return err
+		}
+		index[key] = valuePos{
+			offset: size + headerSize + int64(len(key)),
+			length: pos.length,
+			size:   int64(len(record)),
+		}
+		size += int64(len(record))
+	}
+	commit := encodeRecord(recordCommit, "", encodeIndex(e.applied))
+	if _, err := writer.Write(commit); err != nil {
+		f.Close()
+		return err
+	}
+	size += int64(len(commit))
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, e.path); err != nil {
+		f.Close()
+		return err
+	}
+	// The rename is durable only once the directory is.
+	if err := syncDir(filepath.Dir(e.path)); err != nil {
+		log.Printf("Failed to sync directory of %s: %v", e.path, err)
+	}
+
+	e.file.Close()
+	e.file = f
+	e.index = index
+	e.size = size
+	e.garbage = 0
+	e.lastCommit = int64(len(commit))
+	log.Printf("Compacted data file from %d to %d bytes", before, size)
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openDisk(t *testing.T, dir string) *DiskEngine {
+	t.Helper()
+	e, err := NewDiskEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func mustGet(t *testing.T, e *DiskEngine, key, want string) {
+	t.Helper()
+	got, ok, err := e.Get(key)
+	if err != nil || !ok || got != want {
+		t.Fatalf("get %s: got %q, %v, %v; want %q", key, got, ok, err, want)
+	}
+}
+
+func mustMiss(t *testing.T, e *DiskEngine, key string) {
+	t.Helper()
+	if got, ok, err := e.Get(key); err != nil || ok {
+		t.Fatalf("get %s: got %q, %v, %v; want no value", key, got, ok, err)
+	}
+}
+
+func TestDiskEngineDropsUncommittedWrites(t *testing.T) {
+	dir := t.TempDir()
+	e := openDisk(t, dir)
+	e.Put("a", "1")
+	e.Commit(1)
+	e.Put("a", "2")
+	e.Put("b", "2")
+	e.Delete("a")
+	e.Close()
+
+	e = openDisk(t, dir)
+	defer e.Close()
+	mustGet(t, e, "a", "1")
+	mustMiss(t, e, "b")
+	if got := e.AppliedIndex(); got != 1 {
+		t.Fatalf("applied index: got %d, want 1", got)
+	}
+
+	// The dropped writes are cut off, so new ones follow the last commit.
+	e.Put("c", "3")
+	e.Commit(2)
+	e.Close()
+	e = openDisk(t, dir)
+	mustGet(t, e, "c", "3")
+	mustMiss(t, e, "b")
+}
+
+func TestDiskEngineRecoversFromTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	e := openDisk(t, dir)
+	e.Put("a", "1")
+	e.Commit(1)
+	e.Put("b", "2")
+	e.Commit(2)
+	e.Close()
+
+	// Cut the last commit record in half, as a crash during its write would.
+	path := filepath.Join(dir, "data.db")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-headerSize/2); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openDisk(t, dir)
+	mustGet(t, e, "a", "1")
+	mustMiss(t, e, "b")
+	if got := e.AppliedIndex(); got != 1 {
+		t.Fatalf("applied index: got %d, want 1", got)
+	}
+	e.Put("c", "3")
+	e.Commit(2)
+	e.Close()
+
+	e = openDisk(t, dir)
+	defer e.Close()
+	mustGet(t, e, "c", "3")
+}
+
+func TestDiskEngineRejectsCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	e := openDisk(t, dir)
+	e.Put("a", "1")
+	e.Commit(1)
+	e.Put("b", "2")
+	e.Commit(2)
+	e.Close()
+
+	// Flip the value of b: its record and all after it are discarded.
+	path := filepath.Join(dir, "data.db")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndex(string(data), "b2")
+	data[i+1] = '3'
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e = openDisk(t, dir)
+	defer e.Close()
+	mustGet(t, e, "a", "1")
+	mustMiss(t, e, "b")
+}
+
+func TestDiskEngineCompaction(t *testing.T) {
+	dir := t.TempDir()
+	e := openDisk(t, dir)
+	value := strings.Repeat("x", 1<<20)
+	for i := 1; i <= 8; i++ {
+		e.Put("big", value)
+		e.Commit(i)
+	}
+	e.Put("small", "s")
+	e.Delete("gone")
+	e.Commit(9)
+	before := e.size
+
+	if err := e.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if e.size >= before/4 {
+		t.Fatalf("data file is %d bytes after compaction, was %d", e.size, before)
+	}
+	mustGet(t, e, "big", value)
+	e.Put("after", "a")
+	e.Commit(10)
+	e.Close()
+
+	e = openDisk(t, dir)
+	defer e.Close()
+	mustGet(t, e, "big", value)
+	mustGet(t, e, "small", "s")
+	mustGet(t, e, "after", "a")
+	if got := e.AppliedIndex(); got != 10 {
+		t.Fatalf("applied index: got %d, want 10", got)
+	}
+}
+
+func TestDiskEngineSkipsCompactionOfUncommittedWrites(t *testing.T) {
+	dir := t.TempDir()
+	e := openDisk(t, dir)
+	value := strings.Repeat("x", 1<<20)
+	for i := 1; i <= 8; i++ {
+		e.Put("big", value)
+		e.Commit(i)
+	}
+	e.Put("pending", "p")
+	before := e.size
+	if err := e.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if e.size != before {
+		t.Fatal("compaction rewrote a data file with uncommitted writes")
+	}
+	e.Close()
+
+	e = openDisk(t, dir)
+	defer e.Close()
+	mustMiss(t, e, "pending")
+}
@@ -0,0 +1,82 @@
+package storage
+
+// Engine is the low-level key-value store under Storage. Writes become
+// durable together with the applied log index on Commit.
+type Engine interface {
+	Get(key string) (string, bool, error)
+	Put(key, value string) error
+	Delete(key string) error
+	// WriteBatch applies writes in order, all of them or none.
+	WriteBatch(writes []Write) error
+	Keys() []string
+
+	Commit(appliedIndex int) error
+	AppliedIndex() int
+	Close() error
+}
+
+// Write is a put of Value to Key, or a delete of Key if Delete is set.
+type Write struct {
+	Key    string
+	Value  string
+	Delete bool
+}
+
+type MemoryEngine struct {
+	data    map[string]string
+	applied int
+}
+
+func NewMemoryEngine() *MemoryEngine {
+	return &MemoryEngine{
+		data: make(map[string]string),
+	}
+}
+
+func (e *MemoryEngine) Get(key string) (string, bool, error) {
+	value, ok := e.data[key]
+	return value, ok, nil
+}
+
+func (e *MemoryEngine) Put(key, value string) error {
+	e.data[key] = value
+	return nil
+}
+
+func (e *MemoryEngine) Delete(key string) error {
+	delete(e.data, key)
+	return nil
+}
+
+func (e *MemoryEngine) WriteBatch(writes []Write) error {
+	for _, w := range writes {
+		if w.Delete {
+			delete(e.data, w.Key)
+		} else {
+			e.data[w.Key] = w.Value
+		}
+	}
+	return nil
+}
+
+func (e *MemoryEngine) Keys() []string {
+	keys := make([]string, 0, len(e.data))
+	for key := range e.data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (e *MemoryEngine) Commit(appliedIndex int) error {
+	e.applied = appliedIndex
+	return nil
+}
+
+// AppliedIndex is always zero after a restart, so the log is replayed.
+func (e *MemoryEngine) AppliedIndex() int {
+	return e.applied
+}
+
+func (e *MemoryEngine) Close() error {
+	return nil
+}
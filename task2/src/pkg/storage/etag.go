@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ETag identifies a version of a key without its value.
+func (v Version) ETag() string {
+	return fmt.Sprintf("%d.%d", v.CreateRevision, v.Version)
+}
+
+// Preconditions hold the ETags of If-Match and If-None-Match; "*" stands
+// for any version of an existing key.
+type Preconditions struct {
+	IfMatch     []string
+	IfNoneMatch []string
+}
+
+// Matches reports whether the current version of a key, if found, is one
+// of etags.
+func Matches(etags []string, current Version, found bool) bool {
+	if !found {
+		return false
+	}
+	for _, etag := range etags {
+		if etag == "*" || etag == current.ETag() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check fails with ErrPreconditionFailed unless key satisfies p.
+func (tx *Tx) Check(key string, p Preconditions) error {
+	current, err := tx.Get(key)
+	found := err == nil
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if len(p.IfMatch) > 0 && !Matches(p.IfMatch, current, found) {
+		return ErrPreconditionFailed
+	}
+	if len(p.IfNoneMatch) > 0 && Matches(p.IfNoneMatch, current, found) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
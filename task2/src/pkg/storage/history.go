@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The latest version of a key is stored under the key itself, so a write or
+// a read of the current value touches one small record. Versions it
+// replaced move to records under historyPrefix, one per revision, until
+// compaction drops them.
+const historyPrefix = "\x00hist/"
+
+func historyKey(key string, revision int) string {
+	return fmt.Sprintf("%s%s/%020d", historyPrefix, key, revision)
+}
+
+func parseHistoryKey(name string) (string, int, bool) {
+	rest, ok := strings.CutPrefix(name, historyPrefix)
+	if !ok || len(rest) < 21 || rest[len(rest)-21] != '/' {
+		return "", 0, false
+	}
+	revision, err := strconv.Atoi(rest[len(rest)-20:])
+	if err != nil {
+		return "", 0, false
+	}
+	return rest[:len(rest)-21], revision, true
+}
+
+func (s *Storage) readVersion(name string) (Version, bool, error) {
+	data, ok, err := s.engine.Get(name)
+	if err != nil || !ok {
+		return Version{}, false, err
+	}
+	var version Version
+	if err := json.Unmarshal([]byte(data), &version); err != nil {
+		return Version{}, false, fmt.Errorf("corrupted version %q: %w", name, err)
+	}
+	return version, true, nil
+}
+
+func versionWrite(name string, version Version) (Write, error) {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return Write{}, err
+	}
+	return Write{Key: name, Value: string(data)}, nil
+}
+
+// latest returns the last version written to key, which may be a deletion.
+func (s *Storage) latest(key string) (Version, bool, error) {
+	if err := checkKey(key); err != nil {
+		return Version{}, false, err
+	}
+	return s.readVersion(key)
+}
+
+// versionAt returns the version of key current at revision, if any.
+func (s *Storage) versionAt(key string, revision int) (Version, bool, error) {
+	latest, ok, err := s.latest(key)
+	if err != nil || !ok || latest.Revision <= revision {
+		return latest, ok, err
+	}
+	revisions := s.archive[key]
+	i := sort.SearchInts(revisions, revision+1) - 1
+	if i < 0 {
+		return Version{}, false, nil
+	}
+	return s.readVersion(historyKey(key, revisions[i]))
+}
+
+// versions returns every version of key still stored, oldest first.
+func (s *Storage) versions(key string) ([]Version, error) {
+	versions := make([]Version, 0, len(s.archive[key])+1)
+	for _, revision := range s.archive[key] {
+		version, ok, err := s.readVersion(historyKey(key, revision))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+	latest, ok, err := s.latest(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		versions = append(versions, latest)
+	}
+	return versions, nil
+}
+
+// versionWrites stores the versions an entry wrote to key, archiving the
+// ones they replace, and returns the revisions it archives. Of several
+// versions at one revision only the last is kept, as no read can tell them
+// apart.
+func (s *Storage) versionWrites(key string, versions []Version) ([]Write, []int, error) {
+	previous, ok, err := s.latest(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var writes []Write
+	var archived []int
+	for _, version := range versions {
+		if ok && previous.Revision != version.Revision {
+			w, err := versionWrite(historyKey(key, previous.Revision), previous)
+			if err != nil {
+				return nil, nil, err
+			}
+			writes = append(writes, w)
+			archived = append(archived, previous.Revision)
+		}
+		previous, ok = version, true
+	}
+	w, err := versionWrite(key, previous)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(writes, w), archived, nil
+}
+
+// compactKey drops the versions of key that no read at revision or later
+// can see: those before the one current at revision, and that one too if
+// it is a deletion.
+func (s *Storage) compactKey(key string, revision int) error {
+	latest, ok, err := s.latest(key)
+	if err != nil || !ok {
+		return err
+	}
+	revisions := s.archive[key]
+	drop := sort.SearchInts(revisions, revision+1) - 1
+	if latest.Revision <= revision {
+		drop = len(revisions)
+		if latest.Deleted {
+			if err := s.engine.Delete(key); err != nil {
+				return err
+			}
+		}
+	} else if drop >= 0 {
+		current, _, err := s.readVersion(historyKey(key, revisions[drop]))
+		if err != nil {
+			return err
+		}
+		if current.Deleted {
+			drop++
+		}
+	}
+	if drop <= 0 {
+		return nil
+	}
+	for _, archived := range revisions[:drop] {
+		if err := s.engine.Delete(historyKey(key, archived)); err != nil {
+			return err
+		}
+	}
+	if drop == len(revisions) {
+		delete(s.archive, key)
+	} else {
+		s.archive[key] = revisions[drop:]
+	}
+	return nil
+}
+
+// loadHistory indexes the archived versions.
+func (s *Storage) loadHistory() {
+	for _, name := range s.engine.Keys() {
+		if key, revision, ok := parseHistoryKey(name); ok {
+			s.archive[key] = append(s.archive[key], revision)
+		}
+	}
+	for _, revisions := range s.archive {
+		sort.Ints(revisions)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func put(t *testing.T, s *Storage, revision int, key, value string) {
+	t.Helper()
+	err := s.Update(revision, 0, func(tx *Tx) error {
+		if _, err := tx.Get(key); errors.Is(err, ErrKeyNotFound) {
+			return tx.Create(key, value, WriteOptions{})
+		}
+		return tx.Set(key, value, WriteOptions{})
+	})
+	if err != nil {
+		t.Fatalf("put %s at %d: %v", key, revision, err)
+	}
+	if err := s.Commit(revision); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func del(t *testing.T, s *Storage, revision int, key string) {
+	t.Helper()
+	if err := s.Update(revision, 0, func(tx *Tx) error { return tx.Delete(key) }); err != nil {
+		t.Fatalf("delete %s at %d: %v", key, revision, err)
+	}
+	if err := s.Commit(revision); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newMemoryStorage(t *testing.T) (*Storage, *MemoryEngine) {
+	t.Helper()
+	engine := NewMemoryEngine()
+	s, err := NewStorage(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, engine
+}
+
+func TestHistoryReadsOldVersions(t *testing.T) {
+	s, engine := newMemoryStorage(t)
+	for revision := 1; revision <= 100; revision++ {
+		put(t, s, revision, "k", strconv.Itoa(revision))
+	}
+	// The current record holds one version however often the key changed.
+	data, _, _ := engine.Get("k")
+	var latest Version
+	if err := json.Unmarshal([]byte(data), &latest); err != nil {
+		t.Fatalf("current record is not a single version: %v", err)
+	}
+
+	for _, revision := range []int{1, 50, 100} {
+		version, err := s.GetAt("k", revision)
+		if err != nil || version.Value != strconv.Itoa(revision) {
+			t.Fatalf("GetAt %d: got %q, %v", revision, version.Value, err)
+		}
+	}
+	if version, err := s.GetVersion("k"); err != nil || version.Version != 100 {
+		t.Fatalf("GetVersion: got version %d, %v", version.Version, err)
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	s, engine := newMemoryStorage(t)
+	put(t, s, 1, "a", "a1")
+	put(t, s, 2, "a", "a2")
+	put(t, s, 3, "b", "b3")
+	del(t, s, 4, "b")
+	put(t, s, 5, "a", "a5")
+
+	if err := s.Compact(4); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := s.GetAt("a", 4); err != nil || version.Value != "a2" {
+		t.Fatalf("GetAt a@4: got %q, %v", version.Value, err)
+	}
+	if _, err := s.GetAt("a", 1); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("GetAt a@1: got %v, want %v", err, ErrCompacted)
+	}
+	// b was deleted by revision 4, so nothing of it is left.
+	for _, name := range engine.Keys() {
+		if key, _, ok := parseHistoryKey(name); name == "b" || ok && key == "b" {
+			t.Fatalf("record %q of deleted key survived compaction", name)
+		}
+	}
+	if got := len(s.archive["a"]); got != 1 {
+		t.Fatalf("a keeps %d archived versions, want 1", got)
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrLeaseNotFound = errors.New("lease not found or expired")
+
+// Lease deletes the keys attached to it when it is revoked or runs out
+// without a keep-alive.
+type Lease struct {
+	ID        int   `json:"id"`
+	TTL       int64 `json:"ttl_ms"`
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func (l *Lease) expired(now int64) bool {
+	return l.ExpiresAt <= now
+}
+
+func leaseName(id int) string {
+	return fmt.Sprintf("lease/%d", id)
+}
+
+func (s *Storage) loadLeases() error {
+	for _, key := range s.engine.Keys() {
+		if !strings.HasPrefix(key, metaPrefix+"lease/") {
+			continue
+		}
+		data, _, err := s.engine.Get(key)
+		if err != nil {
+			return err
+		}
+		var lease Lease
+		if err := json.Unmarshal([]byte(data), &lease); err != nil {
+			return fmt.Errorf("corrupted %s: %w", key, err)
+		}
+		s.leases[lease.ID] = &lease
+	}
+	return nil
+}
+
+func (s *Storage) attachKey(key string, lease int) {
+	if old, ok := s.keyLease[key]; ok {
+		delete(s.leaseKeys[old], key)
+		if len(s.leaseKeys[old]) == 0 {
+			delete(s.leaseKeys, old)
+		}
+		delete(s.keyLease, key)
+	}
+	if lease == 0 {
+		return
+	}
+	if s.leaseKeys[lease] == nil {
+		s.leaseKeys[lease] = make(map[string]bool)
+	}
+	s.leaseKeys[lease][key] = true
+	s.keyLease[key] = lease
+}
+
+// Lease returns a lease with its attached keys.
+func (s *Storage) Lease(id int) (Lease, []string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lease, ok := s.leases[id]
+	if !ok {
+		return Lease{}, nil, ErrLeaseNotFound
+	}
+	keys := make([]string, 0, len(s.leaseKeys[id]))
+	for key := range s.leaseKeys[id] {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return *lease, keys, nil
+}
+
+// ExpiredLeases returns up to limit leases that ran out by now.
+func (s *Storage) ExpiredLeases(now int64, limit int) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int, 0)
+	for id, lease := range s.leases {
+		if lease.expired(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+func (tx *Tx) lease(id int) (*Lease, bool) {
+	if lease, ok := tx.leases[id]; ok {
+		return lease, lease != nil
+	}
+	lease, ok := tx.s.leases[id]
+	return lease, ok
+}
+
+func (tx *Tx) stageLease(id int, lease *Lease) {
+	if _, ok := tx.leases[id]; !ok {
+		tx.leaseOrder = append(tx.leaseOrder, id)
+	}
+	tx.leases[id] = lease
+}
+
+// checkLease fails unless lease is 0 or alive at the time of the entry.
+func (tx *Tx) checkLease(id int) error {
+	if id == 0 {
+		return nil
+	}
+	lease, ok := tx.lease(id)
+	if !ok || lease.expired(tx.now) {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+func (tx *Tx) Grant(id int, ttl int64) Lease {
+	lease := &Lease{
+		ID:        id,
+		TTL:       ttl,
+		ExpiresAt: tx.now + ttl,
+	}
+	tx.stageLease(id, lease)
+	return *lease
+}
+
+func (tx *Tx) KeepAlive(id int) (Lease, error) {
+	if err := tx.checkLease(id); err != nil {
+		return Lease{}, err
+	}
+	current, _ := tx.lease(id)
+	lease := *current
+	lease.ExpiresAt = tx.now + lease.TTL
+	tx.stageLease(id, &lease)
+	return lease, nil
+}
+
+func (tx *Tx) leaseKeys(id int) []string {
+	keys := make(map[string]bool)
+	for key := range tx.s.leaseKeys[id] {
+		keys[key] = true
+	}
+	for _, key := range tx.order {
+		versions := tx.staged[key]
+		last := versions[len(versions)-1]
+		keys[key] = !last.Deleted && last.Lease == id
+	}
+
+	attached := make([]string, 0, len(keys))
+	for key, ok := range keys {
+		if ok {
+			attached = append(attached, key)
+		}
+	}
+	slices.Sort(attached)
+	return attached
+}
+
+// Revoke deletes the lease and every key attached to it, and gives up the
+// locks it holds or waits for.
+func (tx *Tx) Revoke(id int) error {
+	return tx.revoke(id, EventDelete)
+}
+
+// ExpireLease revokes the lease if it ran out and reports whether it did.
+// A keep-alive may have arrived since the leader saw it expire.
+func (tx *Tx) ExpireLease(id int) (bool, error) {
+	lease, ok := tx.lease(id)
+	if !ok || !lease.expired(tx.now) {
+		return false, nil
+	}
+	return true, tx.revoke(id, EventExpire)
+}
+
+func (tx *Tx) revoke(id int, op EventType) error {
+	if _, ok := tx.lease(id); !ok {
+		return ErrLeaseNotFound
+	}
+	for _, key := range tx.leaseKeys(id) {
+		if err := tx.write(key, Version{Op: op, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	tx.stageLease(id, nil)
+	return tx.releaseLease(id)
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrNotLockOwner = errors.New("lease neither holds nor waits for the lock")
+
+type LockOwner struct {
+	Lease int `json:"lease"`
+	// Token is the revision at which the lease got the lock; it only grows,
+	// so resources can reject writes from a holder that lost the lock.
+	Token int `json:"token,omitempty"`
+}
+
+// Lock is held by one lease at a time; the others wait in FIFO order.
+type Lock struct {
+	Name    string      `json:"name"`
+	Holder  *LockOwner  `json:"holder,omitempty"`
+	Waiters []LockOwner `json:"waiters"`
+}
+
+type LockState struct {
+	Lease    int  `json:"lease"`
+	Acquired bool `json:"acquired"`
+	Token    int  `json:"token,omitempty"`
+	// Position is 1 for the first waiter.
+	Position int `json:"position,omitempty"`
+}
+
+func (l *Lock) clone() *Lock {
+	clone := &Lock{
+		Name:    l.Name,
+		Waiters: slices.Clone(l.Waiters),
+	}
+	if l.Holder != nil {
+		holder := *l.Holder
+		clone.Holder = &holder
+	}
+	return clone
+}
+
+// StateOf reports where lease stands in the lock.
+func (l *Lock) StateOf(lease int) (LockState, bool) {
+	if l.Holder != nil && l.Holder.Lease == lease {
+		return LockState{Lease: lease, Acquired: true, Token: l.Holder.Token}, true
+	}
+	for i, w := range l.Waiters {
+		if w.Lease == lease {
+			return LockState{Lease: lease, Position: i + 1}, true
+		}
+	}
+	return LockState{}, false
+}
+
+func lockName(name string) string {
+	return "lock/" + name
+}
+
+func (s *Storage) loadLocks() error {
+	for _, key := range s.engine.Keys() {
+		if !strings.HasPrefix(key, metaPrefix+"lock/") {
+			continue
+		}
+		data, _, err := s.engine.Get(key)
+		if err != nil {
+			return err
+		}
+		var lock Lock
+		if err := json.Unmarshal([]byte(data), &lock); err != nil {
+			return fmt.Errorf("corrupted %s: %w", key, err)
+		}
+		s.locks[lock.Name] = &lock
+	}
+	return nil
+}
+
+func (s *Storage) Lock(name string) (Lock, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lock, ok := s.locks[name]
+	if !ok {
+		return Lock{}, false
+	}
+	return *lock.clone(), true
+}
+
+func (tx *Tx) lock(name string) (*Lock, bool) {
+	if lock, ok := tx.locks[name]; ok {
+		return lock, lock != nil
+	}
+	lock, ok := tx.s.locks[name]
+	return lock, ok
+}
+
+func (tx *Tx) stageLock(name string, lock *Lock) {
+	if _, ok := tx.locks[name]; !ok {
+		tx.lockOrder = append(tx.lockOrder, name)
+	}
+	if lock != nil && lock.Holder == nil && len(lock.Waiters) == 0 {
+		lock = nil
+	}
+	tx.locks[name] = lock
+}
+
+// promote hands a free lock to the first waiter whose lease is still alive.
+func (tx *Tx) promote(lock *Lock) {
+	for lock.Holder == nil && len(lock.Waiters) > 0 {
+		next := lock.Waiters[0]
+		lock.Waiters = lock.Waiters[1:]
+		if tx.checkLease(next.Lease) == nil {
+			lock.Holder = &LockOwner{Lease: next.Lease, Token: tx.revision}
+		}
+	}
+}
+
+// Acquire takes the lock for lease or queues it. Acquiring again returns
+// the current state without queueing twice.
+func (tx *Tx) Acquire(name string, lease int) (LockState, error) {
+	if lease == 0 {
+		return LockState{}, ErrLeaseNotFound
+	}
+	if err := tx.checkLease(lease); err != nil {
+		return LockState{}, err
+	}
+	if err := tx.checkNamespace(name); err != nil {
+		return LockState{}, err
+	}
+
+	lock := &Lock{Name: name, Waiters: []LockOwner{}}
+	if current, ok := tx.lock(name); ok {
+		if state, ok := current.StateOf(lease); ok {
+			return state, nil
+		}
+		lock = current.clone()
+	}
+	lock.Waiters = append(lock.Waiters, LockOwner{Lease: lease})
+	tx.promote(lock)
+	tx.stageLock(name, lock)
+
+	state, _ := lock.StateOf(lease)
+	return state, nil
+}
+
+// Release gives up the lock or leaves its queue.
+func (tx *Tx) Release(name string, lease int) error {
+	current, ok := tx.lock(name)
+	if !ok {
+		return ErrNotLockOwner
+	}
+	if _, ok := current.StateOf(lease); !ok {
+		return ErrNotLockOwner
+	}
+
+	lock := current.clone()
+	if lock.Holder != nil && lock.Holder.Lease == lease {
+		lock.Holder = nil
+	}
+	lock.Waiters = slices.DeleteFunc(lock.Waiters, func(w LockOwner) bool {
+		return w.Lease == lease
+	})
+	tx.promote(lock)
+	tx.stageLock(name, lock)
+	return nil
+}
+
+// releaseLease drops lease from every lock, in name order so that all
+// replicas promote waiters the same way.
+func (tx *Tx) releaseLease(lease int) error {
+	names := make([]string, 0)
+	for name := range tx.s.locks {
+		if _, ok := tx.locks[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name, lock := range tx.locks {
+		if lock != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		lock, _ := tx.lock(name)
+		if _, ok := lock.StateOf(lease); !ok {
+			continue
+		}
+		if err := tx.Release(name, lease); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrBadNamespace      = errors.New("namespace names are 1-64 letters, digits, '.', '_' or '-'")
+)
+
+// Keys of a namespace are stored as namespacePrefix + name + "/" + key.
+// Keys of the default namespace, named "", are stored as is and can not
+// start with namespacePrefix, so neither can see the other.
+const namespacePrefix = "\x01"
+
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Namespace bounds the keys and bytes in it; zero means unlimited.
+type Namespace struct {
+	Name     string `json:"name"`
+	MaxKeys  int    `json:"max_keys,omitempty"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+func ValidateNamespace(name string) error {
+	if !namespaceName.MatchString(name) {
+		return ErrBadNamespace
+	}
+	return nil
+}
+
+// IsReserved reports whether a client may not name key directly.
+func IsReserved(key string) bool {
+	return strings.HasPrefix(key, "\x00") || strings.HasPrefix(key, namespacePrefix)
+}
+
+// NamespaceKey returns the stored form of key in namespace ns.
+func NamespaceKey(ns, key string) string {
+	if ns == "" {
+		return key
+	}
+	return namespacePrefix + ns + "/" + key
+}
+
+// SplitKey is the inverse of NamespaceKey.
+func SplitKey(stored string) (string, string) {
+	if !strings.HasPrefix(stored, namespacePrefix) {
+		return "", stored
+	}
+	ns, key, _ := strings.Cut(strings.TrimPrefix(stored, namespacePrefix), "/")
+	return ns, key
+}
+
+func namespaceRecord(name string) string {
+	return "namespace/" + name
+}
+
+func (s *Storage) loadNamespaces() error {
+	for _, key := range s.engine.Keys() {
+		if !strings.HasPrefix(key, metaPrefix+"namespace/") {
+			continue
+		}
+		data, _, err := s.engine.Get(key)
+		if err != nil {
+			return err
+		}
+		var ns Namespace
+		if err := json.Unmarshal([]byte(data), &ns); err != nil {
+			return fmt.Errorf("corrupted %s: %w", key, err)
+		}
+		s.namespaces[ns.Name] = &ns
+	}
+	return nil
+}
+
+// Namespace returns a namespace with its usage. The default namespace
+// always exists.
+func (s *Storage) Namespace(name string) (Namespace, Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name == "" {
+		return Namespace{}, s.usage[""], nil
+	}
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return Namespace{}, Usage{}, ErrNamespaceNotFound
+	}
+	return *ns, s.usage[name], nil
+}
+
+func (s *Storage) Namespaces() []Namespace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	namespaces := make([]Namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		namespaces = append(namespaces, *ns)
+	}
+	slices.SortFunc(namespaces, func(a, b Namespace) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return namespaces
+}
+
+func (tx *Tx) namespace(name string) (*Namespace, bool) {
+	if ns, ok := tx.namespaces[name]; ok {
+		return ns, ns != nil
+	}
+	ns, ok := tx.s.namespaces[name]
+	return ns, ok
+}
+
+func (tx *Tx) stageNamespace(name string, ns *Namespace) {
+	if _, ok := tx.namespaces[name]; !ok {
+		tx.namespaceOrder = append(tx.namespaceOrder, name)
+	}
+	tx.namespaces[name] = ns
+}
+
+// checkNamespace fails unless the namespace of key exists, so that writes
+// racing with a drop do not bring its keys back.
+func (tx *Tx) checkNamespace(key string) error {
+	ns, _ := SplitKey(key)
+	if ns == "" {
+		return nil
+	}
+	if _, ok := tx.namespace(ns); !ok {
+		return ErrNamespaceNotFound
+	}
+	return nil
+}
+
+func (tx *Tx) CreateNamespace(ns Namespace) error {
+	if err := ValidateNamespace(ns.Name); err != nil {
+		return err
+	}
+	if _, ok := tx.namespace(ns.Name); ok {
+		return ErrNamespaceExists
+	}
+	tx.stageNamespace(ns.Name, &ns)
+	return nil
+}
+
+// DropNamespace deletes a namespace with all its keys and locks.
+func (tx *Tx) DropNamespace(name string) error {
+	if _, ok := tx.namespace(name); !ok {
+		return ErrNamespaceNotFound
+	}
+	prefix := NamespaceKey(name, "")
+	keys := make([]string, 0)
+	for _, key := range tx.s.keys[sort.SearchStrings(tx.s.keys, prefix):] {
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range tx.order {
+		if strings.HasPrefix(key, prefix) && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	// Expired keys not deleted yet go as well.
+	for _, key := range keys {
+		version, ok, err := tx.latest(key)
+		if err != nil {
+			return err
+		}
+		if !ok || version.Deleted {
+			continue
+		}
+		if err := tx.write(key, Version{Op: EventDelete, Deleted: true}); err != nil {
+			return err
+		}
+	}
+
+	locks := make([]string, 0)
+	for lock := range tx.s.locks {
+		if strings.HasPrefix(lock, prefix) {
+			locks = append(locks, lock)
+		}
+	}
+	for lock := range tx.locks {
+		if strings.HasPrefix(lock, prefix) && !slices.Contains(locks, lock) {
+			locks = append(locks, lock)
+		}
+	}
+	slices.Sort(locks)
+	for _, lock := range locks {
+		tx.stageLock(lock, nil)
+	}
+	tx.stageNamespace(name, nil)
+	return nil
+}
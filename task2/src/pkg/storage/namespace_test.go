@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func createNamespace(t *testing.T, s *Storage, revision int, ns Namespace) {
+	t.Helper()
+	if err := s.Update(revision, 0, func(tx *Tx) error { return tx.CreateNamespace(ns) }); err != nil {
+		t.Fatalf("create namespace %s: %v", ns.Name, err)
+	}
+	if err := s.Commit(revision); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRangeOfDefaultNamespaceHidesOthers(t *testing.T) {
+	s, _ := newMemoryStorage(t)
+	createNamespace(t, s, 1, Namespace{Name: "team"})
+	put(t, s, 2, "a", "1")
+	put(t, s, 3, NamespaceKey("team", "b"), "2")
+
+	result, err := s.Range(RangeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 1 || len(result.KVs) != 1 || result.KVs[0].Key != "a" {
+		t.Fatalf("default range: got %+v", result)
+	}
+	for _, opts := range []RangeOptions{
+		{Start: namespacePrefix},
+		{End: namespacePrefix + "z"},
+		{Prefix: namespacePrefix},
+		{Prefix: "\x00hist/"},
+	} {
+		if _, err := s.Range(opts); !errors.Is(err, ErrKeyReserved) {
+			t.Fatalf("range %#v: got %v, want %v", opts, err, ErrKeyReserved)
+		}
+	}
+
+	result, err = s.Range(RangeOptions{Namespace: "team", Prefix: NamespaceKey("team", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 1 || len(result.KVs) != 1 || result.KVs[0].Key != NamespaceKey("team", "b") {
+		t.Fatalf("namespace range: got %+v", result)
+	}
+}
+
+func TestDropNamespaceDeletesKeysAndLocks(t *testing.T) {
+	s, _ := newMemoryStorage(t)
+	createNamespace(t, s, 1, Namespace{Name: "team"})
+	createNamespace(t, s, 2, Namespace{Name: "other"})
+	put(t, s, 3, NamespaceKey("team", "a"), "1")
+	put(t, s, 4, NamespaceKey("team", "b"), "22")
+	put(t, s, 5, NamespaceKey("other", "a"), "1")
+	put(t, s, 6, "a", "1")
+	err := s.Update(7, 1000, func(tx *Tx) error {
+		tx.Grant(7, 60000)
+		if _, err := tx.Acquire(NamespaceKey("team", "lock"), 7); err != nil {
+			return err
+		}
+		_, err := tx.Acquire(NamespaceKey("other", "lock"), 7)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(7); err != nil {
+		t.Fatal(err)
+	}
+	if _, usage, err := s.Namespace("team"); err != nil || usage.Keys != 2 {
+		t.Fatalf("team usage: got %+v, %v", usage, err)
+	}
+
+	if err := s.Update(8, 1000, func(tx *Tx) error { return tx.DropNamespace("team") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(8); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{NamespaceKey("team", "a"), NamespaceKey("team", "b")} {
+		if _, err := s.Get(key); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("get %q: got %v, want %v", key, err, ErrKeyNotFound)
+		}
+	}
+	if _, ok := s.Lock(NamespaceKey("team", "lock")); ok {
+		t.Fatal("lock of dropped namespace survived")
+	}
+	if _, _, err := s.Namespace("team"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Fatalf("dropped namespace: got %v, want %v", err, ErrNamespaceNotFound)
+	}
+
+	// The other namespaces keep their keys, locks and usage.
+	for _, key := range []string{NamespaceKey("other", "a"), "a"} {
+		if _, err := s.Get(key); err != nil {
+			t.Fatalf("get %q: %v", key, err)
+		}
+	}
+	if _, ok := s.Lock(NamespaceKey("other", "lock")); !ok {
+		t.Fatal("lock of other namespace is gone")
+	}
+	if _, usage, err := s.Namespace("other"); err != nil || usage.Keys != 1 {
+		t.Fatalf("other usage: got %+v, %v", usage, err)
+	}
+
+	// Writes racing with the drop do not bring it back.
+	err = s.Update(9, 1000, func(tx *Tx) error {
+		return tx.Create(NamespaceKey("team", "c"), "1", WriteOptions{})
+	})
+	if !errors.Is(err, ErrNamespaceNotFound) {
+		t.Fatalf("write to dropped namespace: got %v, want %v", err, ErrNamespaceNotFound)
+	}
+	createNamespace(t, s, 9, Namespace{Name: "team"})
+	if _, usage, err := s.Namespace("team"); err != nil || usage != (Usage{}) {
+		t.Fatalf("recreated namespace usage: got %+v, %v", usage, err)
+	}
+}
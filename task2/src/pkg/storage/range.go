@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type KeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Revision    int    `json:"revision"`
+}
+
+type RangeOptions struct {
+	// Namespace scopes the range. Its bounds are stored keys, already
+	// prefixed by NamespaceKey; those of the default namespace may not be
+	// reserved, and the keys of every other namespace are left out.
+	Namespace string
+
+	// Start is inclusive, End is exclusive; an empty End is unbounded.
+	Start  string
+	End    string
+	Prefix string
+
+	Limit     int
+	Reverse   bool
+	KeysOnly  bool
+	CountOnly bool
+}
+
+type RangeResult struct {
+	KVs []KeyValue
+	// Count is the number of keys in the range regardless of Limit.
+	Count int
+	// Next is the key to resume from when More is set.
+	More bool
+	Next string
+}
+
+// PrefixEnd returns the smallest key greater than every key with prefix,
+// or "" when there is none.
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// Bounds narrows Start and End to the keys with Prefix.
+func (o RangeOptions) Bounds() (string, string) {
+	start, end := o.Start, o.End
+	if o.Prefix != "" {
+		start = max(start, o.Prefix)
+		if prefixEnd := PrefixEnd(o.Prefix); prefixEnd != "" && (end == "" || prefixEnd < end) {
+			end = prefixEnd
+		}
+	}
+	return start, end
+}
+
+func (s *Storage) indexKey(key string, last Version) {
+	live := !last.Deleted
+	i, found := slices.BinarySearch(s.keys, key)
+	switch {
+	case live && !found:
+		s.keys = slices.Insert(s.keys, i, key)
+	case !live && found:
+		s.keys = slices.Delete(s.keys, i, i+1)
+	}
+	if live && last.ExpiresAt > 0 {
+		s.expiries[key] = last.ExpiresAt
+	} else {
+		delete(s.expiries, key)
+	}
+	if live {
+		s.attachKey(key, last.Lease)
+	} else {
+		s.attachKey(key, 0)
+	}
+
+	ns, _ := SplitKey(key)
+	usage := s.usage[ns]
+	if size, ok := s.sizes[key]; ok {
+		s.bytes -= int64(size)
+		usage.Keys--
+		usage.Bytes -= int64(size)
+		delete(s.sizes, key)
+	}
+	if live {
+		size := len(key) + len(last.Value)
+		s.sizes[key] = size
+		s.bytes += int64(size)
+		usage.Keys++
+		usage.Bytes += int64(size)
+	}
+	if usage.Keys == 0 {
+		delete(s.usage, ns)
+	} else {
+		s.usage[ns] = usage
+	}
+}
+
+func (s *Storage) buildIndex() error {
+	if err := s.loadLeases(); err != nil {
+		return err
+	}
+	if err := s.loadLocks(); err != nil {
+		return err
+	}
+	if err := s.loadNamespaces(); err != nil {
+		return err
+	}
+	s.loadHistory()
+	for _, key := range s.engine.Keys() {
+		if strings.HasPrefix(key, "\x00") {
+			continue
+		}
+		version, ok, err := s.latest(key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.indexKey(key, version)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) Range(opts RangeOptions) (RangeResult, error) {
+	if opts.Namespace == "" && (IsReserved(opts.Start) || IsReserved(opts.End) || IsReserved(opts.Prefix)) {
+		return RangeResult{}, ErrKeyReserved
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start, end := opts.Bounds()
+	lo := sort.SearchStrings(s.keys, start)
+	hi := len(s.keys)
+	if end != "" {
+		hi = sort.SearchStrings(s.keys, end)
+	}
+	if lo >= hi {
+		return RangeResult{KVs: []KeyValue{}}, nil
+	}
+	// Ranges of the default namespace skip the keys of the others.
+	hidden := func(key string) bool {
+		return opts.Namespace == "" && strings.HasPrefix(key, namespacePrefix)
+	}
+	now := time.Now().UnixMilli()
+	count := hi - lo
+	for key, expiresAt := range s.expiries {
+		if expiresAt <= now && key >= start && (end == "" || key < end) && !hidden(key) {
+			count--
+		}
+	}
+	if opts.Namespace == "" {
+		// The keys of all namespaces sit together in the index.
+		nlo := max(lo, sort.SearchStrings(s.keys, namespacePrefix))
+		nhi := min(hi, sort.SearchStrings(s.keys, PrefixEnd(namespacePrefix)))
+		count -= max(nhi-nlo, 0)
+	}
+	if opts.CountOnly {
+		return RangeResult{KVs: []KeyValue{}, Count: count}, nil
+	}
+
+	keys := slices.DeleteFunc(slices.Clone(s.keys[lo:hi]), func(key string) bool {
+		expiresAt, ok := s.expiries[key]
+		return ok && expiresAt <= now || hidden(key)
+	})
+	if opts.Reverse {
+		slices.Reverse(keys)
+	}
+	result := RangeResult{
+		KVs:   make([]KeyValue, 0),
+		Count: count,
+	}
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		result.More = true
+		result.Next = keys[opts.Limit]
+		keys = keys[:opts.Limit]
+	}
+	for _, key := range keys {
+		version, err := s.get(key)
+		if errors.Is(err, ErrKeyNotFound) {
+			// Expired since the scan started.
+			continue
+		}
+		if err != nil {
+			return RangeResult{}, err
+		}
+		kv := KeyValue{
+			Key:      key,
+			Revision: version.Revision,
+		}
+		if !opts.KeysOnly {
+			kv.Value = version.Value
+			kv.ContentType = version.ContentType
+		}
+		result.KVs = append(result.KVs, kv)
+	}
+	return result, nil
+}
@@ -2,143 +2,306 @@ package storage
 
 import (
 	"errors"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	ErrKeyNotFound = errors.New("key not found")
 	ErrKeyExists   = errors.New("key already exists")
 	ErrKeyChanged  = errors.New("key changed")
+	ErrKeyReserved = errors.New("key is reserved")
+
+	ErrCompacted      = errors.New("revision has been compacted")
+	ErrFutureRevision = errors.New("revision is not applied yet")
 )
 
+// Keys with this prefix hold state machine bookkeeping, not user data.
+const metaPrefix = "\x00meta/"
+
+// Version is a value of a key as written by the entry at Revision. The
+// version counts writes to the key since it was last created.
+type Version struct {
+	Revision  int       `json:"revision"`
+	Version   int       `json:"version,omitempty"`
+	Op        EventType `json:"op"`
+	Value     string    `json:"value"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	ExpiresAt int64     `json:"expires_at,omitempty"`
+	Lease     int       `json:"lease,omitempty"`
+	// ContentType is whatever the writer declared; empty means text.
+	ContentType string `json:"content_type,omitempty"`
+	// CreateRevision is the revision that created the key; with Version it
+	// tells apart keys deleted and created again.
+	CreateRevision int `json:"create_revision,omitempty"`
+}
+
+// Expired reports whether the TTL of the version ran out by now (unix ms).
+func (v Version) Expired(now int64) bool {
+	return v.ExpiresAt > 0 && v.ExpiresAt <= now
+}
+
 type Storage struct {
-	data map[string]string
-	mu   sync.RWMutex
+	engine Engine
+	mu     sync.RWMutex
+
+	// keys holds the live user keys in order, expiries the deadlines of
+	// those with a TTL.
+	keys     []string
+	expiries map[string]int64
+	// archive holds the revisions of the replaced versions of each key,
+	// in order.
+	archive map[string][]int
+	// sizes hold the bytes of each live key and its value, bytes their sum
+	// and usage the same per namespace.
+	sizes map[string]int
+	bytes int64
+	usage map[string]Usage
+
+	namespaces map[string]*Namespace
+
+	leases    map[int]*Lease
+	leaseKeys map[int]map[string]bool
+	keyLease  map[string]int
+	locks     map[string]*Lock
+
+	watchers []*Watcher
+	pending  []Event
 }
 
-func NewStorage() *Storage {
-	return &Storage{
-		data: make(map[string]string),
-		mu:   sync.RWMutex{},
+func NewStorage(engine Engine) (*Storage, error) {
+	s := &Storage{
+		engine:   engine,
+		mu:       sync.RWMutex{},
+		expiries: make(map[string]int64),
+		archive:  make(map[string][]int),
+		sizes:    make(map[string]int),
+		usage:    make(map[string]Usage),
+
+		namespaces: make(map[string]*Namespace),
+
+		leases:    make(map[int]*Lease),
+		leaseKeys: make(map[int]map[string]bool),
+		keyLease:  make(map[string]int),
+		locks:     make(map[string]*Lock),
+	}
+	if err := s.buildIndex(); err != nil {
+		return nil, err
 	}
+	return s, nil
 }
 
-func (s *Storage) Create(key, value string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	_, ok := s.data[key]
-	if ok {
-		return ErrKeyExists
+func checkKey(key string) error {
+	if strings.HasPrefix(key, "\x00") {
+		return ErrKeyReserved
 	}
-	s.data[key] = value
 	return nil
 }
 
-func (s *Storage) ValidateCreate(key string) error {
+func (s *Storage) get(key string) (Version, error) {
+	version, ok, err := s.latest(key)
+	if err != nil {
+		return Version{}, err
+	}
+	if !ok || version.Deleted {
+		return Version{}, ErrKeyNotFound
+	}
+	// Expired keys stay until the leader deletes them through the log.
+	if version.Expired(time.Now().UnixMilli()) {
+		return Version{}, ErrKeyNotFound
+	}
+	return version, nil
+}
+
+func (s *Storage) Get(key string) (string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if ok {
-		return ErrKeyExists
-	}
-	return nil
+	version, err := s.get(key)
+	return version.Value, err
 }
 
-func (s *Storage) Get(key string) (string, error) {
+func (s *Storage) GetVersion(key string) (Version, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	value, ok := s.data[key]
-	if !ok {
-		return "", ErrKeyNotFound
+	return s.get(key)
+}
+
+// GetAt returns the version of key that was current at revision.
+func (s *Storage) GetAt(key string, revision int) (Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if revision > s.engine.AppliedIndex() {
+		return Version{}, ErrFutureRevision
+	}
+	if revision < s.compacted() {
+		return Version{}, ErrCompacted
+	}
+	version, ok, err := s.versionAt(key, revision)
+	if err != nil {
+		return Version{}, err
 	}
-	return value, nil
+	if !ok || version.Deleted {
+		return Version{}, ErrKeyNotFound
+	}
+	return version, nil
 }
 
 func (s *Storage) ValidateGet(key string) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
-	}
-	return nil
+	_, err := s.get(key)
+	return err
 }
 
-func (s *Storage) Set(key, value string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Revision is the log index of the last applied entry.
+func (s *Storage) Revision() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	return s.engine.AppliedIndex()
+}
+
+func (s *Storage) compacted() int {
+	data, ok, err := s.engine.Get(metaPrefix + "compacted")
+	if err != nil || !ok {
+		return 0
 	}
-	s.data[key] = value
-	return nil
+	revision, _ := strconv.Atoi(data)
+	return revision
 }
 
-func (s *Storage) ValidateSet(key string) error {
+// ExpiredKeys returns up to limit keys whose TTL ran out by now.
+func (s *Storage) ExpiredKeys(now int64, limit int) []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	keys := make([]string, 0)
+	for key, expiresAt := range s.expiries {
+		if expiresAt <= now {
+			keys = append(keys, key)
+		}
 	}
-	return nil
+	slices.Sort(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
 }
 
-func (s *Storage) CAS(key, value, oldValue string) error {
+func (s *Storage) CompactedRevision() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.compacted()
+}
+
+// Compact drops the versions that no read at revision or later can see.
+func (s *Storage) Compact(revision int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	if revision <= s.compacted() {
+		return ErrCompacted
 	}
-	if s.data[key] != oldValue {
-		return ErrKeyChanged
+	if revision > s.engine.AppliedIndex() {
+		return ErrFutureRevision
 	}
-	s.data[key] = value
-	return nil
+	for _, key := range s.engine.Keys() {
+		if strings.HasPrefix(key, "\x00") {
+			continue
+		}
+		if err := s.compactKey(key, revision); err != nil {
+			return err
+		}
+	}
+	return s.engine.Put(metaPrefix+"compacted", strconv.Itoa(revision))
 }
 
-func (s *Storage) ValidateCAS(key, oldValue string) error {
+func (s *Storage) GetMeta(name string) (string, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
-	}
-	if s.data[key] != oldValue {
-		return ErrKeyChanged
+	return s.engine.Get(metaPrefix + name)
+}
+
+func (s *Storage) SetMeta(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.engine.Put(metaPrefix+name, value)
+}
+
+func (s *Storage) DeleteMeta(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.engine.Delete(metaPrefix + name)
+}
+
+// MetaNames lists the meta entries whose names start with prefix.
+func (s *Storage) MetaNames(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0)
+	for _, key := range s.engine.Keys() {
+		if strings.HasPrefix(key, metaPrefix+prefix) {
+			names = append(names, strings.TrimPrefix(key, metaPrefix))
+		}
 	}
-	return nil
+	return names
 }
 
-func (s *Storage) Delete(key string) error {
+// Commit makes the writes of the entry at appliedIndex durable.
+func (s *Storage) Commit(appliedIndex int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	if err := s.engine.Commit(appliedIndex); err != nil {
+		return err
 	}
-	delete(s.data, key)
+	s.publish()
 	return nil
 }
 
-func (s *Storage) ValidateDelete(key string) error {
+func (s *Storage) AppliedIndex() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.engine.AppliedIndex()
+}
+
+func (s *Storage) Close() error {
+	return s.engine.Close()
+}
+
+type Usage struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Usage counts the live keys and the bytes of them and their values.
+func (s *Storage) Usage() Usage {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, ok := s.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	return Usage{
+		Keys:  len(s.keys),
+		Bytes: s.bytes,
 	}
-	return nil
+}
+
+// Size returns the bytes key and its value take, 0 for missing keys.
+func (s *Storage) Size(key string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sizes[key]
 }
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Tx stages the writes of one entry so they reach the engine all together
+// or not at all.
+type Tx struct {
+	s        *Storage
+	revision int
+	now      int64
+	// staged holds the versions written to each key, in order.
+	staged map[string][]Version
+	order  []string
+	events []Event
+
+	leases     map[int]*Lease
+	leaseOrder []int
+
+	locks     map[string]*Lock
+	lockOrder []string
+
+	namespaces     map[string]*Namespace
+	namespaceOrder []string
+}
+
+// WriteOptions attach a TTL deadline (unix ms) or a lease to a written key.
+// Zero values keep those of the current version on update, except for
+// ContentType, which always describes the value written with it.
+type WriteOptions struct {
+	ExpiresAt   int64
+	Lease       int
+	ContentType string
+}
+
+// Update runs fn at revision and applies its writes only if it succeeds.
+// TTLs are judged at now, the timestamp of the entry, not the local clock.
+func (s *Storage) Update(revision int, now int64, fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Tx{
+		s:        s,
+		revision: revision,
+		now:      now,
+		staged:   make(map[string][]Version),
+		leases:   make(map[int]*Lease),
+		locks:    make(map[string]*Lock),
+
+		namespaces: make(map[string]*Namespace),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	// Everything goes to the engine in one batch before any of it is
+	// indexed, so a failed write leaves no trace.
+	var writes []Write
+	archived := make(map[string][]int)
+	for _, key := range tx.order {
+		w, revisions, err := s.versionWrites(key, tx.staged[key])
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w...)
+		archived[key] = revisions
+	}
+	for _, id := range tx.leaseOrder {
+		w, err := metaWrite(leaseName(id), tx.leases[id])
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+	}
+	for _, name := range tx.lockOrder {
+		w, err := metaWrite(lockName(name), tx.locks[name])
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+	}
+	for _, name := range tx.namespaceOrder {
+		w, err := metaWrite(namespaceRecord(name), tx.namespaces[name])
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+	}
+	if err := s.engine.WriteBatch(writes); err != nil {
+		return err
+	}
+
+	for _, key := range tx.order {
+		versions := tx.staged[key]
+		s.archive[key] = append(s.archive[key], archived[key]...)
+		s.indexKey(key, versions[len(versions)-1])
+	}
+	for _, id := range tx.leaseOrder {
+		setOrDelete(s.leases, id, tx.leases[id])
+	}
+	for _, name := range tx.lockOrder {
+		setOrDelete(s.locks, name, tx.locks[name])
+	}
+	for _, name := range tx.namespaceOrder {
+		setOrDelete(s.namespaces, name, tx.namespaces[name])
+	}
+	s.pending = append(s.pending, tx.events...)
+	return nil
+}
+
+// metaWrite stores v under the meta record name, or deletes the record if
+// v is nil.
+func metaWrite[T any](name string, v *T) (Write, error) {
+	if v == nil {
+		return Write{Key: metaPrefix + name, Delete: true}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Write{}, err
+	}
+	return Write{Key: metaPrefix + name, Value: string(data)}, nil
+}
+
+func setOrDelete[K comparable, V any](m map[K]*V, key K, v *V) {
+	if v == nil {
+		delete(m, key)
+	} else {
+		m[key] = v
+	}
+}
+
+func (tx *Tx) latest(key string) (Version, bool, error) {
+	if versions, ok := tx.staged[key]; ok {
+		return versions[len(versions)-1], true, nil
+	}
+	return tx.s.latest(key)
+}
+
+func (tx *Tx) Get(key string) (Version, error) {
+	version, ok, err := tx.latest(key)
+	if err != nil {
+		return Version{}, err
+	}
+	if !ok || version.Deleted || version.Expired(tx.now) {
+		return Version{}, ErrKeyNotFound
+	}
+	return version, nil
+}
+
+func (tx *Tx) write(key string, version Version) error {
+	if err := tx.checkNamespace(key); err != nil {
+		return err
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	version.Revision = tx.revision
+	if !version.Deleted {
+		version.Version = 1
+		version.CreateRevision = tx.revision
+		if current, err := tx.Get(key); err == nil {
+			version.Version = current.Version + 1
+			version.CreateRevision = current.CreateRevision
+		}
+	}
+
+	if _, ok := tx.staged[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.staged[key] = append(tx.staged[key], version)
+	tx.events = append(tx.events, eventOf(key, version))
+	return nil
+}
+
+func (tx *Tx) Create(key, value string, opts WriteOptions) error {
+	_, err := tx.Get(key)
+	if err == nil {
+		return ErrKeyExists
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if err := tx.checkLease(opts.Lease); err != nil {
+		return err
+	}
+	return tx.write(key, Version{Op: EventCreate, Value: value, ExpiresAt: opts.ExpiresAt, Lease: opts.Lease, ContentType: opts.ContentType})
+}
+
+func (tx *Tx) Set(key, value string, opts WriteOptions) error {
+	current, err := tx.Get(key)
+	if err != nil {
+		return err
+	}
+	if opts.ExpiresAt == 0 {
+		opts.ExpiresAt = current.ExpiresAt
+	}
+	if opts.Lease == 0 {
+		opts.Lease = current.Lease
+	}
+	if err := tx.checkLease(opts.Lease); err != nil {
+		return err
+	}
+	return tx.write(key, Version{Op: EventUpdate, Value: value, ExpiresAt: opts.ExpiresAt, Lease: opts.Lease, ContentType: opts.ContentType})
+}
+
+// Put writes key whether it exists or not. Unlike Set it keeps nothing of
+// the current version: a TTL or lease not in opts is dropped.
+func (tx *Tx) Put(key, value string, opts WriteOptions) error {
+	op := EventUpdate
+	if _, err := tx.Get(key); errors.Is(err, ErrKeyNotFound) {
+		op = EventCreate
+	} else if err != nil {
+		return err
+	}
+	if err := tx.checkLease(opts.Lease); err != nil {
+		return err
+	}
+	return tx.write(key, Version{Op: op, Value: value, ExpiresAt: opts.ExpiresAt, Lease: opts.Lease, ContentType: opts.ContentType})
+}
+
+func (tx *Tx) CAS(key, value, oldValue string) error {
+	current, err := tx.Get(key)
+	if err != nil {
+		return err
+	}
+	if current.Value != oldValue {
+		return ErrKeyChanged
+	}
+	return tx.write(key, Version{Op: EventCAS, Value: value, ExpiresAt: current.ExpiresAt, Lease: current.Lease, ContentType: current.ContentType})
+}
+
+func (tx *Tx) Delete(key string) error {
+	if _, err := tx.Get(key); err != nil {
+		return err
+	}
+	return tx.write(key, Version{Op: EventDelete, Deleted: true})
+}
+
+// Expire deletes key if its TTL ran out and reports whether it did. The key
+// may have been rewritten since the leader saw it expire.
+func (tx *Tx) Expire(key string) (bool, error) {
+	version, ok, err := tx.latest(key)
+	if err != nil {
+		return false, err
+	}
+	if !ok || version.Deleted || !version.Expired(tx.now) {
+		return false, nil
+	}
+	return true, tx.write(key, Version{Op: EventExpire, Deleted: true})
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateRollsBackOnError(t *testing.T) {
+	s, engine := newMemoryStorage(t)
+	put(t, s, 1, "a", "1")
+
+	failure := errors.New("failure")
+	err := s.Update(2, 0, func(tx *Tx) error {
+		if err := tx.Set("a", "2", WriteOptions{}); err != nil {
+			return err
+		}
+		if err := tx.Create("b", "2", WriteOptions{}); err != nil {
+			return err
+		}
+		tx.Grant(2, 1000)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("update: got %v, want %v", err, failure)
+	}
+	if err := s.Commit(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := s.Get("a"); err != nil || value != "1" {
+		t.Fatalf("get a: got %q, %v", value, err)
+	}
+	if _, err := s.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("get b: got %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, ok, _ := engine.Get(historyKey("a", 1)); ok {
+		t.Fatal("failed update archived the version it would have replaced")
+	}
+	if _, _, err := s.Lease(2); err == nil {
+		t.Fatal("failed update granted a lease")
+	}
+
+	// Later entries see none of the failed writes.
+	if err := s.Update(3, 0, func(tx *Tx) error {
+		return tx.Create("b", "3", WriteOptions{})
+	}); err != nil {
+		t.Fatalf("create after rollback: %v", err)
+	}
+	if version, err := s.GetVersion("b"); err != nil || version.Version != 1 {
+		t.Fatalf("version of b: got %d, %v", version.Version, err)
+	}
+}
+
+// failingEngine rejects batches once failing is set, like a full disk.
+type failingEngine struct {
+	*MemoryEngine
+	failing bool
+}
+
+func (e *failingEngine) WriteBatch(writes []Write) error {
+	if e.failing {
+		return errors.New("disk full")
+	}
+	return e.MemoryEngine.WriteBatch(writes)
+}
+
+func TestUpdateIndexesNothingWhenTheWriteFails(t *testing.T) {
+	engine := &failingEngine{MemoryEngine: NewMemoryEngine()}
+	s, err := NewStorage(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(t, s, 1, "a", "1")
+
+	engine.failing = true
+	err = s.Update(2, 0, func(tx *Tx) error {
+		if err := tx.Set("a", "2", WriteOptions{}); err != nil {
+			return err
+		}
+		if err := tx.Create("b", "2", WriteOptions{}); err != nil {
+			return err
+		}
+		tx.Grant(2, 1000)
+		return tx.CreateNamespace(Namespace{Name: "team"})
+	})
+	if err == nil {
+		t.Fatal("update succeeded on a failing engine")
+	}
+	if value, err := s.Get("a"); err != nil || value != "1" {
+		t.Fatalf("get a: got %q, %v", value, err)
+	}
+	if _, err := s.Get("b"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("get b: got %v, want %v", err, ErrKeyNotFound)
+	}
+	if len(s.archive["a"]) != 0 {
+		t.Fatalf("failed update archived revisions %v of a", s.archive["a"])
+	}
+	if _, _, err := s.Lease(2); err == nil {
+		t.Fatal("failed update granted a lease")
+	}
+	if _, _, err := s.Namespace("team"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Fatalf("namespace: got %v, want %v", err, ErrNamespaceNotFound)
+	}
+	if result, err := s.Range(RangeOptions{}); err != nil || result.Count != 1 {
+		t.Fatalf("range: got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"raft/pkg/jsonvalue"
+)
+
+func (v Version) MarshalJSON() ([]byte, error) {
+	type plain Version
+	var binary jsonvalue.Binary
+	v.Value, binary.ValueBase64 = jsonvalue.Encode(v.Value)
+	return jsonvalue.Marshal(plain(v), binary)
+}
+
+func (v *Version) UnmarshalJSON(data []byte) error {
+	type plain Version
+	binary, err := jsonvalue.Unmarshal(data, (*plain)(v))
+	if err != nil {
+		return err
+	}
+	v.Value = jsonvalue.Decode(v.Value, binary.ValueBase64)
+	return nil
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	var binary jsonvalue.Binary
+	e.Value, binary.ValueBase64 = jsonvalue.Encode(e.Value)
+	return jsonvalue.Marshal(plain(e), binary)
+}
+
+func (kv KeyValue) MarshalJSON() ([]byte, error) {
+	type plain KeyValue
+	var binary jsonvalue.Binary
+	kv.Value, binary.ValueBase64 = jsonvalue.Encode(kv.Value)
+	return jsonvalue.Marshal(plain(kv), binary)
+}
+
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plain Record
+	var binary jsonvalue.Binary
+	r.Value, binary.ValueBase64 = jsonvalue.Encode(r.Value)
+	return jsonvalue.Marshal(plain(r), binary)
+}
+
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type plain Record
+	binary, err := jsonvalue.Unmarshal(data, (*plain)(r))
+	if err != nil {
+		return err
+	}
+	r.Value = jsonvalue.Decode(r.Value, binary.ValueBase64)
+	return nil
+}
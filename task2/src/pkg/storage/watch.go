@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var ErrWatcherLagging = errors.New("watcher fell behind, resume from the last seen revision")
+
+const watchBuffer = 256
+
+type EventType string
+
+const (
+	EventCreate EventType = "create"
+	EventUpdate EventType = "update"
+	EventCAS    EventType = "cas"
+	EventDelete EventType = "delete"
+	EventExpire EventType = "expire"
+)
+
+type Event struct {
+	Type        EventType `json:"type"`
+	Key         string    `json:"key"`
+	Value       string    `json:"value,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Revision    int       `json:"revision"`
+}
+
+type Watcher struct {
+	key    string
+	prefix bool
+	events chan Event
+	err    error
+}
+
+// Events is closed when the watcher is canceled or falls behind; Err tells
+// which one happened.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+func (w *Watcher) matches(key string) bool {
+	// Watchers of the default namespace skip the keys of the others.
+	if strings.HasPrefix(key, namespacePrefix) != strings.HasPrefix(w.key, namespacePrefix) {
+		return false
+	}
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+func eventOf(key string, version Version) Event {
+	return Event{
+		Type:        version.Op,
+		Key:         key,
+		Value:       version.Value,
+		ContentType: version.ContentType,
+		Revision:    version.Revision,
+	}
+}
+
+// Watch streams changes of key, or of every key starting with it when
+// prefix is set. A positive revision first replays the changes made at
+// that revision and later.
+func (s *Storage) Watch(key string, prefix bool, revision int) (*Watcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &Watcher{
+		key:    key,
+		prefix: prefix,
+	}
+	var history []Event
+	if revision > 0 {
+		if revision <= s.compacted() {
+			return nil, ErrCompacted
+		}
+		var err error
+		history, err = s.eventsSince(w, revision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.events = make(chan Event, len(history)+watchBuffer)
+	for _, event := range history {
+		w.events <- event
+	}
+	s.watchers = append(s.watchers, w)
+	return w, nil
+}
+
+func (s *Storage) eventsSince(w *Watcher, revision int) ([]Event, error) {
+	applied := s.engine.AppliedIndex()
+	events := make([]Event, 0)
+	for _, key := range s.engine.Keys() {
+		if strings.HasPrefix(key, "\x00") || !w.matches(key) {
+			continue
+		}
+		versions, err := s.versions(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			// Versions past the applied index belong to the entry being
+			// applied right now and are published by its Commit.
+			if version.Revision >= revision && version.Revision <= applied {
+				events = append(events, eventOf(key, version))
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Revision != events[j].Revision {
+			return events[i].Revision < events[j].Revision
+		}
+		return events[i].Key < events[j].Key
+	})
+	return events, nil
+}
+
+func (s *Storage) CancelWatch(w *Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeWatcher(w, nil)
+}
+
+func (s *Storage) removeWatcher(w *Watcher, err error) {
+	for i, other := range s.watchers {
+		if other == w {
+			s.watchers = append(s.watchers[:i], s.watchers[i+1:]...)
+			w.err = err
+			close(w.events)
+			return
+		}
+	}
+}
+
+// publish hands the events of a committed entry to the watchers.
+func (s *Storage) publish() {
+	for _, event := range s.pending {
+		for _, w := range append([]*Watcher{}, s.watchers...) {
+			if !w.matches(event.Key) {
+				continue
+			}
+			select {
+			case w.events <- event:
+			default:
+				s.removeWatcher(w, ErrWatcherLagging)
+			}
+		}
+	}
+	s.pending = s.pending[:0]
+}